@@ -0,0 +1,363 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+// 审计动作
+const (
+	ActionConfigLoad         = "config.load"
+	ActionPushSubmit         = "push.submit"
+	ActionNotificationRead   = "notification.read"
+	ActionNotificationDelete = "notification.delete"
+	ActionNotificationClear  = "notification.clear"
+	ActionAccessDenied       = "access.denied"
+	ActionSMTPAuth           = "smtp.auth"
+	ActionSMTPRelay          = "smtp.relay"
+	ActionSMTPQueueRetry     = "smtp.queue.retry"
+	ActionSMTPQueueDelete    = "smtp.queue.delete"
+	ActionSMTPQueueExpire    = "smtp.queue.expire"
+)
+
+// 审计结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+	ResultAborted = "aborted" // 调用方在请求完成前断开连接或超时
+)
+
+const (
+	// defaultFilePath 默认审计日志文件
+	defaultFilePath = "log/audit.log"
+	// defaultQueryLimit 默认查询条数
+	defaultQueryLimit = 100
+	// maxQueryLimit 最大查询条数
+	maxQueryLimit = 1000
+	// maxLineSize 单条审计记录的最大长度
+	maxLineSize = 1 << 20
+)
+
+// Event 审计事件
+// Hash为sha256(PrevHash + 不含Hash的事件JSON)，任意一条被修改或删除都会导致后续哈希校验失败
+type Event struct {
+	Seq      int64                  `json:"seq"`
+	Time     time.Time              `json:"time"`
+	Actor    string                 `json:"actor"`            // 调用方，如api_key:ops-script、jwt:alice、smtp:relay_user、system
+	Action   string                 `json:"action"`           // 动作
+	Target   string                 `json:"target,omitempty"` // 操作对象，如接收者别名、通知ID
+	Source   string                 `json:"source,omitempty"` // 来源地址
+	Result   string                 `json:"result"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	PrevHash string                 `json:"prev_hash"`
+	Hash     string                 `json:"hash"`
+}
+
+// computeHash 计算事件哈希
+func (e Event) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log 只追加的审计日志
+// 查询和校验另行打开文件读取，只读取已完整写入的size字节，不占用追加使用的锁
+type Log struct {
+	path     string
+	file     *os.File
+	seq      int64
+	lastHash string
+	size     int64 // 已完整写入的字节数
+	mutex    sync.Mutex
+}
+
+var Manager *Log
+
+// InitAudit 初始化审计日志，恢复哈希链末尾状态并校验已有记录
+func InitAudit() error {
+	auditConfig := config.AppConfig.Audit
+	if !auditConfig.Enabled {
+		logger.Info("审计日志未启用")
+		return nil
+	}
+
+	path := auditConfig.FilePath
+	if path == "" {
+		path = defaultFilePath
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	auditLog := &Log{path: path}
+	result, err := scan(path, -1, nil)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	if result.Valid {
+		auditLog.seq, auditLog.lastHash = result.seq, result.LastHash
+	} else {
+		// 保留原有记录供排查，新记录接在最后一条之后继续链接
+		logger.Errorf("审计日志哈希链校验失败: 序号 %d, %s", result.BrokenAt, result.Error)
+		auditLog.seq, auditLog.lastHash = lastRecord(path)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	auditLog.file = file
+	auditLog.size = info.Size()
+
+	Manager = auditLog
+	logger.Infof("审计日志已启用: %s, 已有记录: %d", path, result.Events)
+	return nil
+}
+
+// Record 记录审计事件，未启用审计时忽略
+func Record(actor, action, target, source, result string, details map[string]interface{}) {
+	if Manager == nil {
+		return
+	}
+	if err := Manager.Append(Event{
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Source:  source,
+		Result:  result,
+		Details: details,
+	}); err != nil {
+		logger.Errorf("写入审计日志失败: %v", err)
+	}
+}
+
+// Append 追加审计事件
+func (l *Log) Append(event Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	event.Seq = l.seq + 1
+	event.Time = time.Now()
+	event.PrevHash = l.lastHash
+
+	hash, err := event.computeHash()
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(data, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.seq = event.Seq
+	l.lastHash = event.Hash
+	return nil
+}
+
+// committedSize 返回已完整写入的字节数
+func (l *Log) committedSize() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.size
+}
+
+// Close 关闭审计日志文件
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// VerifyResult 哈希链校验结果
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Events   int64  `json:"events"`
+	LastHash string `json:"last_hash,omitempty"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // 第一条校验失败的记录序号
+	Error    string `json:"error,omitempty"`
+
+	seq int64 // 最后一条记录的序号
+}
+
+// Verify 从头校验整个哈希链
+func (l *Log) Verify() (VerifyResult, error) {
+	return scan(l.path, l.committedSize(), nil)
+}
+
+// scan 顺序读取并校验文件前size字节中的记录（size<0时读取整个文件），visit不为nil时对每条记录回调
+func scan(path string, size int64, visit func(Event)) (VerifyResult, error) {
+	result := VerifyResult{Valid: true}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if size >= 0 {
+		reader = io.LimitReader(file, size)
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var prevHash string
+	var seq int64
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return result.broken(seq+1, "记录格式错误"), nil
+		}
+		if event.Seq != seq+1 {
+			return result.broken(seq+1, fmt.Sprintf("序号不连续，实际为 %d", event.Seq)), nil
+		}
+		if event.PrevHash != prevHash {
+			return result.broken(event.Seq, "prev_hash与上一条记录不一致"), nil
+		}
+		hash, err := event.computeHash()
+		if err != nil || hash != event.Hash {
+			return result.broken(event.Seq, "记录内容与哈希不一致"), nil
+		}
+
+		if visit != nil {
+			visit(event)
+		}
+		prevHash = event.Hash
+		seq = event.Seq
+		result.Events++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	result.LastHash = prevHash
+	result.seq = seq
+	return result, nil
+}
+
+// lastRecord 读取最后一条可解析记录的序号和哈希
+func lastRecord(path string) (int64, string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var seq int64
+	var hash string
+	for scanner.Scan() {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) == nil && event.Seq > seq {
+			seq, hash = event.Seq, event.Hash
+		}
+	}
+	return seq, hash
+}
+
+// broken 标记校验失败
+func (r VerifyResult) broken(seq int64, message string) VerifyResult {
+	r.Valid = false
+	r.BrokenAt = seq
+	r.Error = message
+	return r
+}
+
+// Filter 查询条件
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// match 检查事件是否满足查询条件
+func (f Filter) match(event Event) bool {
+	if f.Actor != "" && event.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && event.Action != f.Action {
+		return false
+	}
+	if f.Target != "" && event.Target != f.Target {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && event.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Query 查询审计事件，按时间倒序返回最近的Limit条
+func (l *Log) Query(filter Filter) ([]Event, VerifyResult, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	// 只保留最近的limit条匹配记录
+	var events []Event
+	result, err := scan(l.path, l.committedSize(), func(event Event) {
+		if !filter.match(event) {
+			return
+		}
+		events = append(events, event)
+		if len(events) > limit {
+			events = events[1:]
+		}
+	})
+	if err != nil {
+		return nil, result, err
+	}
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, result, nil
+}
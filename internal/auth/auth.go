@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+// 权限
+const (
+	PermissionPush  = "push"  // 推送消息、查询任务
+	PermissionRead  = "read"  // 查询通知、统计等只读接口
+	PermissionAdmin = "admin" // 修改或删除通知等管理接口，包含read权限
+)
+
+// 认证方式
+const (
+	MethodAPIKey = "api_key"
+)
+
+// ContextKey 认证主体在gin上下文中的键
+const ContextKey = "auth_principal"
+
+// wildcard 通配符，表示不限制
+const wildcard = "*"
+
+// Principal 认证主体
+type Principal struct {
+	Method      string   `json:"method"`
+	Name        string   `json:"name"`
+	Recipients  []string `json:"recipients,omitempty"`
+	Platforms   []string `json:"platforms,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// String 返回认证主体的标识，如 api_key:ops-script
+func (p *Principal) String() string {
+	return p.Method + ":" + p.Name
+}
+
+// HasPermission 检查是否拥有指定权限
+func (p *Principal) HasPermission(permission string) bool {
+	if permission == PermissionAdmin && !adminMethodAllowed(p.Method) {
+		return false
+	}
+	for _, granted := range p.Permissions {
+		if granted == permission || granted == wildcard {
+			return true
+		}
+		if granted == PermissionAdmin && permission == PermissionRead {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRecipient 检查是否允许推送到指定接收者
+func (p *Principal) AllowsRecipient(alias string) bool {
+	return allows(p.Recipients, alias)
+}
+
+// AllowsPlatform 检查是否允许指定平台
+func (p *Principal) AllowsPlatform(platform string) bool {
+	return allows(p.Platforms, platform)
+}
+
+// AllPlatforms 检查是否不限制平台
+func (p *Principal) AllPlatforms() bool {
+	return allows(p.Platforms, wildcard)
+}
+
+// adminMethodAllowed 检查认证方式是否允许使用admin权限，未配置时只允许SSO登录的JWT用户
+func adminMethodAllowed(method string) bool {
+	methods := config.AppConfig.Auth.AdminMethods
+	if len(methods) == 0 {
+		return method == MethodJWT
+	}
+	return containsString(methods, wildcard) || containsString(methods, method)
+}
+
+// allows 列表为空或包含通配符时不限制
+func allows(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == wildcard || item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyEntry 已加载的API密钥
+type apiKeyEntry struct {
+	hash      []byte
+	principal *Principal
+}
+
+var apiKeys []apiKeyEntry
+
+// InitAuth 加载认证配置
+func InitAuth() {
+	apiKeys = nil
+
+	for _, keyConfig := range config.AppConfig.Auth.APIKeys {
+		var hash []byte
+		switch {
+		case keyConfig.KeyHash != "":
+			decoded, err := hex.DecodeString(strings.TrimSpace(keyConfig.KeyHash))
+			if err != nil || len(decoded) != sha256.Size {
+				logger.Errorf("API密钥 %s 的key_hash不是有效的SHA-256十六进制摘要，已忽略", keyConfig.Name)
+				continue
+			}
+			hash = decoded
+		case keyConfig.Key != "":
+			sum := sha256.Sum256([]byte(keyConfig.Key))
+			hash = sum[:]
+		default:
+			logger.Errorf("API密钥 %s 未配置key或key_hash，已忽略", keyConfig.Name)
+			continue
+		}
+
+		apiKeys = append(apiKeys, apiKeyEntry{
+			hash: hash,
+			principal: &Principal{
+				Method:      MethodAPIKey,
+				Name:        keyConfig.Name,
+				Recipients:  keyConfig.Recipients,
+				Platforms:   keyConfig.Platforms,
+				Permissions: keyConfig.Permissions,
+			},
+		})
+	}
+
+	loadHMACClients()
+	loadJWT()
+
+	if config.AppConfig.Auth.Enabled {
+		logger.Infof("接口认证已启用，API密钥数量: %d，HMAC调用方数量: %d", len(apiKeys), len(hmacClients))
+	} else {
+		logger.Warn("接口认证未启用，所有接口均可匿名访问")
+	}
+}
+
+// Enabled 检查是否启用接口认证
+func Enabled() bool {
+	return config.AppConfig.Auth.Enabled
+}
+
+// AuthenticateAPIKey 校验API密钥
+func AuthenticateAPIKey(key string) (*Principal, bool) {
+	sum := sha256.Sum256([]byte(key))
+
+	var matched *Principal
+	for _, entry := range apiKeys {
+		// 逐一比较，避免通过响应时间推断密钥
+		if subtle.ConstantTimeCompare(sum[:], entry.hash) == 1 {
+			matched = entry.principal
+		}
+	}
+	return matched, matched != nil
+}
+
+// HashKey 计算API密钥的SHA-256十六进制摘要，用于配置key_hash
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// FromContext 获取当前请求的认证主体，未认证时返回nil
+func FromContext(c *gin.Context) *Principal {
+	if value, exists := c.Get(ContextKey); exists {
+		if principal, ok := value.(*Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
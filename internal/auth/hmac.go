@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"PushServer/internal/config"
+)
+
+// HMAC签名请求头
+const (
+	HeaderKeyID     = "X-Push-Key-Id"
+	HeaderTimestamp = "X-Push-Timestamp"
+	HeaderNonce     = "X-Push-Nonce"
+	HeaderSignature = "X-Push-Signature"
+)
+
+const (
+	// MethodHMAC HMAC请求签名认证
+	MethodHMAC = "hmac"
+
+	// defaultMaxSkew 默认允许的时钟偏差
+	defaultMaxSkew = 5 * time.Minute
+	// maxNonceLength nonce的最大长度
+	maxNonceLength = 128
+)
+
+// hmacClient 已加载的HMAC调用方
+type hmacClient struct {
+	secret    []byte
+	principal *Principal
+}
+
+var (
+	hmacClients = make(map[string]*hmacClient)
+	nonces      = newNonceCache()
+)
+
+// loadHMACClients 加载HMAC调用方配置
+func loadHMACClients() {
+	hmacClients = make(map[string]*hmacClient)
+	for _, clientConfig := range config.AppConfig.Auth.HMAC.Clients {
+		if clientConfig.KeyID == "" || clientConfig.Secret == "" {
+			continue
+		}
+		name := clientConfig.Name
+		if name == "" {
+			name = clientConfig.KeyID
+		}
+		hmacClients[clientConfig.KeyID] = &hmacClient{
+			secret: []byte(clientConfig.Secret),
+			principal: &Principal{
+				Method:      MethodHMAC,
+				Name:        name,
+				Recipients:  clientConfig.Recipients,
+				Platforms:   clientConfig.Platforms,
+				Permissions: clientConfig.Permissions,
+			},
+		}
+	}
+}
+
+// SignedRequest 待校验的签名请求
+type SignedRequest struct {
+	KeyID     string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	Path      string // 包含查询字符串的请求路径
+	Body      []byte
+}
+
+// StringToSign 构建待签名字符串：
+// METHOD\nPATH\nTIMESTAMP\nNONCE\nhex(sha256(body))
+func StringToSign(method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s", method, path, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+}
+
+// Sign 使用HMAC-SHA256计算签名并进行Base64编码
+func Sign(secret, stringToSign string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// AuthenticateHMAC 校验HMAC签名请求
+func AuthenticateHMAC(req SignedRequest) (*Principal, error) {
+	client, exists := hmacClients[req.KeyID]
+	if !exists {
+		return nil, errors.New("未知的密钥ID")
+	}
+
+	if req.Nonce == "" || len(req.Nonce) > maxNonceLength {
+		return nil, errors.New("无效的nonce")
+	}
+
+	unix, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("无效的时间戳")
+	}
+	maxSkew := maxClockSkew()
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return nil, errors.New("时间戳超出允许的时钟偏差")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil {
+		return nil, errors.New("签名格式错误")
+	}
+	h := hmac.New(sha256.New, client.secret)
+	h.Write([]byte(StringToSign(req.Method, req.Path, req.Timestamp, req.Nonce, req.Body)))
+	if !hmac.Equal(signature, h.Sum(nil)) {
+		return nil, errors.New("签名不匹配")
+	}
+
+	// 签名通过后才记录nonce，避免未授权请求占用缓存
+	if !nonces.add(req.KeyID+":"+req.Nonce, 2*maxSkew) {
+		return nil, errors.New("重复的请求(nonce已使用)")
+	}
+
+	return client.principal, nil
+}
+
+// maxClockSkew 获取允许的时钟偏差
+func maxClockSkew() time.Duration {
+	if skew := config.AppConfig.Auth.HMAC.MaxSkew; skew > 0 {
+		return time.Duration(skew) * time.Second
+	}
+	return defaultMaxSkew
+}
+
+// nonceCache 已使用nonce的缓存，用于防重放
+type nonceCache struct {
+	entries   map[string]time.Time
+	mutex     sync.Mutex
+	lastPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{
+		entries:   make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// add 记录nonce，已存在且未过期时返回false
+func (nc *nonceCache) add(nonce string, ttl time.Duration) bool {
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(nc.lastPrune) > time.Minute {
+		for key, expireAt := range nc.entries {
+			if now.After(expireAt) {
+				delete(nc.entries, key)
+			}
+		}
+		nc.lastPrune = now
+	}
+
+	if expireAt, exists := nc.entries[nonce]; exists && now.Before(expireAt) {
+		return false
+	}
+	nc.entries[nonce] = now.Add(ttl)
+	return true
+}
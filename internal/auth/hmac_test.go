@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"PushServer/internal/config"
+)
+
+const (
+	testKeyID  = "ci-runner"
+	testSecret = "test-secret"
+	testBody   = `{"recipient":"ops","content":{"title":"disk"}}`
+)
+
+// setupHMAC 加载测试用的HMAC调用方并清空nonce缓存
+func setupHMAC(t *testing.T, maxSkew int) {
+	t.Helper()
+	previous := config.AppConfig
+	t.Cleanup(func() {
+		config.AppConfig = previous
+		nonces = newNonceCache()
+	})
+	config.AppConfig = &config.Config{
+		Auth: config.AuthConfig{
+			HMAC: config.HMACConfig{
+				MaxSkew: maxSkew,
+				Clients: []config.HMACClientConfig{
+					{Name: "ci", KeyID: testKeyID, Secret: testSecret, Permissions: []string{PermissionPush}},
+					{KeyID: "other", Secret: "other-secret", Permissions: []string{PermissionRead}},
+				},
+			},
+		},
+	}
+	loadHMACClients()
+	nonces = newNonceCache()
+}
+
+// signedRequest 构建带签名请求头的httptest请求
+func signedRequest(method, target, body, keyID, secret string, timestamp time.Time, nonce string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	req.Header.Set(HeaderKeyID, keyID)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(secret, StringToSign(method, req.URL.RequestURI(), ts, nonce, []byte(body))))
+	return req
+}
+
+// authenticate 按中间件的方式从HTTP请求中提取签名字段并校验
+func authenticate(req *http.Request) (*Principal, error) {
+	body, _ := io.ReadAll(req.Body)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return AuthenticateHMAC(SignedRequest{
+		KeyID:     req.Header.Get(HeaderKeyID),
+		Timestamp: req.Header.Get(HeaderTimestamp),
+		Nonce:     req.Header.Get(HeaderNonce),
+		Signature: req.Header.Get(HeaderSignature),
+		Method:    req.Method,
+		Path:      req.URL.RequestURI(),
+		Body:      body,
+	})
+}
+
+func TestStringToSign(t *testing.T) {
+	got := StringToSign("POST", "/api/v1/push?wait=2000", "1700000000", "n-0001", []byte(testBody))
+	want := "POST\n/api/v1/push?wait=2000\n1700000000\nn-0001\n" +
+		"d9dab9ab6c884181de893475163d9147fcf54c9c07a6b5716f49e396bb9017cb"
+	if got != want {
+		t.Errorf("StringToSign =\n%q\nwant\n%q", got, want)
+	}
+
+	// 空请求体使用空串的SHA-256
+	if got := StringToSign("GET", "/api/v1/statistics", "1", "n", nil); !strings.HasSuffix(got, "\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855") {
+		t.Errorf("StringToSign with empty body = %q", got)
+	}
+
+	if got := Sign(testSecret, want); got != "32emWInhiL5nM3hxmTOANZJBbHyOhnUEUqS7hbCuIsA=" {
+		t.Errorf("Sign = %s", got)
+	}
+}
+
+func TestAuthenticateHMAC(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		maxSkew int
+		build   func() *http.Request
+		wantErr string
+	}{
+		{
+			name: "valid",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push?wait=2000", testBody, testKeyID, testSecret, now, "n-valid")
+			},
+		},
+		{
+			name: "within skew",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now.Add(-4*time.Minute), "n-old-ok")
+			},
+		},
+		{
+			name: "unknown key id",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, "nobody", testSecret, now, "n-unknown")
+			},
+			wantErr: "未知的密钥ID",
+		},
+		{
+			name: "wrong secret",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, "other-secret", now, "n-secret")
+			},
+			wantErr: "签名不匹配",
+		},
+		{
+			name: "tampered body",
+			build: func() *http.Request {
+				req := signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "n-body")
+				req.Body = io.NopCloser(strings.NewReader(strings.Replace(testBody, "ops", "all", 1)))
+				return req
+			},
+			wantErr: "签名不匹配",
+		},
+		{
+			name: "tampered query",
+			build: func() *http.Request {
+				req := signedRequest(http.MethodPost, "/api/v1/push?wait=2000", testBody, testKeyID, testSecret, now, "n-query")
+				req.URL.RawQuery = "wait=60000"
+				return req
+			},
+			wantErr: "签名不匹配",
+		},
+		{
+			name: "changed method",
+			build: func() *http.Request {
+				req := signedRequest(http.MethodGet, "/api/v1/task/1", "", testKeyID, testSecret, now, "n-method")
+				req.Method = http.MethodDelete
+				return req
+			},
+			wantErr: "签名不匹配",
+		},
+		{
+			name: "malformed signature",
+			build: func() *http.Request {
+				req := signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "n-malformed")
+				req.Header.Set(HeaderSignature, "not base64!")
+				return req
+			},
+			wantErr: "签名格式错误",
+		},
+		{
+			name: "timestamp too old",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now.Add(-6*time.Minute), "n-past")
+			},
+			wantErr: "时钟偏差",
+		},
+		{
+			name: "timestamp in the future",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now.Add(6*time.Minute), "n-future")
+			},
+			wantErr: "时钟偏差",
+		},
+		{
+			name:    "configured max_skew",
+			maxSkew: 30,
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now.Add(-time.Minute), "n-skew")
+			},
+			wantErr: "时钟偏差",
+		},
+		{
+			name: "non-numeric timestamp",
+			build: func() *http.Request {
+				req := signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "n-ts")
+				req.Header.Set(HeaderTimestamp, now.Format(time.RFC3339))
+				return req
+			},
+			wantErr: "无效的时间戳",
+		},
+		{
+			name: "missing nonce",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "")
+			},
+			wantErr: "无效的nonce",
+		},
+		{
+			name: "nonce too long",
+			build: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, strings.Repeat("n", maxNonceLength+1))
+			},
+			wantErr: "无效的nonce",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupHMAC(t, tt.maxSkew)
+			principal, err := authenticate(tt.build())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if principal.Method != MethodHMAC || principal.Name != "ci" || !principal.HasPermission(PermissionPush) {
+					t.Errorf("principal = %+v", principal)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticateHMACRejectsReplay(t *testing.T) {
+	setupHMAC(t, 0)
+	now := time.Now()
+
+	if _, err := authenticate(signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "n-replay")); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	_, err := authenticate(signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "n-replay"))
+	if err == nil || !strings.Contains(err.Error(), "nonce已使用") {
+		t.Fatalf("replayed request error = %v, want nonce reuse", err)
+	}
+
+	// nonce按密钥ID区分，其他调用方可以使用相同的nonce
+	if _, err := authenticate(signedRequest(http.MethodGet, "/api/v1/statistics", "", "other", "other-secret", now, "n-replay")); err != nil {
+		t.Errorf("same nonce from another key: %v", err)
+	}
+}
+
+func TestAuthenticateHMACStoresNonceOnlyAfterVerification(t *testing.T) {
+	setupHMAC(t, 0)
+	now := time.Now()
+
+	// 签名错误或时间戳过期的请求不能占用nonce，否则攻击者可以提前占用合法调用方的nonce
+	forged := signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, "guessed-secret", now, "n-shared")
+	if _, err := authenticate(forged); err == nil {
+		t.Fatal("forged request accepted")
+	}
+	expired := signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now.Add(-time.Hour), "n-shared")
+	if _, err := authenticate(expired); err == nil {
+		t.Fatal("expired request accepted")
+	}
+
+	if _, err := authenticate(signedRequest(http.MethodPost, "/api/v1/push", testBody, testKeyID, testSecret, now, "n-shared")); err != nil {
+		t.Fatalf("legitimate request rejected after failed attempts: %v", err)
+	}
+}
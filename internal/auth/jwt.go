@@ -0,0 +1,418 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+const (
+	// MethodJWT JWT/OIDC令牌认证
+	MethodJWT = "jwt"
+
+	// defaultJWKSRefresh 默认JWKS刷新间隔
+	defaultJWKSRefresh = time.Hour
+	// minJWKSRefetch 遇到未知kid时两次强制刷新的最小间隔
+	minJWKSRefetch = time.Minute
+)
+
+// defaultJWTAlgorithms 默认允许的签名算法
+var defaultJWTAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512"}
+
+var (
+	staticJWTKeys map[string]crypto.PublicKey
+	jwks          = &jwksCache{}
+)
+
+// loadJWT 加载JWT静态公钥
+func loadJWT() {
+	staticJWTKeys = make(map[string]crypto.PublicKey)
+	jwks = &jwksCache{}
+
+	jwtConfig := config.AppConfig.Auth.JWT
+	if !jwtConfig.Enabled {
+		return
+	}
+
+	for i, keyConfig := range jwtConfig.StaticKeys {
+		data := []byte(keyConfig.PublicKey)
+		if keyConfig.File != "" {
+			fileData, err := os.ReadFile(keyConfig.File)
+			if err != nil {
+				logger.Errorf("读取JWT公钥文件 %s 失败: %v", keyConfig.File, err)
+				continue
+			}
+			data = fileData
+		}
+
+		key, err := parsePublicKeyPEM(data)
+		if err != nil {
+			logger.Errorf("解析JWT静态公钥 #%d 失败: %v", i+1, err)
+			continue
+		}
+		staticJWTKeys[keyConfig.KeyID] = key
+	}
+
+	if jwtConfig.JWKSURL == "" && len(staticJWTKeys) == 0 {
+		logger.Warn("JWT认证已启用，但未配置jwks_url或static_keys，所有令牌都将被拒绝")
+	}
+	logger.Infof("JWT认证已启用，静态公钥数量: %d，JWKS: %s", len(staticJWTKeys), jwtConfig.JWKSURL)
+}
+
+// JWTEnabled 检查是否启用JWT认证
+func JWTEnabled() bool {
+	return config.AppConfig.Auth.JWT.Enabled
+}
+
+// LooksLikeJWT 检查令牌是否为JWT格式(三段式)
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// AuthenticateJWT 校验JWT令牌并根据角色声明映射权限
+func AuthenticateJWT(tokenString string) (*Principal, error) {
+	jwtConfig := config.AppConfig.Auth.JWT
+
+	algorithms := jwtConfig.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultJWTAlgorithms
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithLeeway(time.Duration(jwtConfig.Leeway) * time.Second),
+		jwt.WithExpirationRequired(),
+	}
+	if jwtConfig.Issuer != "" {
+		options = append(options, jwt.WithIssuer(jwtConfig.Issuer))
+	}
+	if jwtConfig.Audience != "" {
+		options = append(options, jwt.WithAudience(jwtConfig.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, lookupJWTKey, options...); err != nil {
+		return nil, err
+	}
+
+	subjectClaim := jwtConfig.SubjectClaim
+	if subjectClaim == "" {
+		subjectClaim = "sub"
+	}
+	subject, _ := claimValue(claims, subjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("令牌缺少%s声明", subjectClaim)
+	}
+
+	principal := &Principal{
+		Method: MethodJWT,
+		Name:   subject,
+	}
+	roles := claimStrings(claimValue(claims, jwtConfig.RoleClaim))
+	for _, mapping := range jwtConfig.RoleMapping {
+		if !containsString(roles, mapping.Role) {
+			continue
+		}
+		principal.Permissions = mergeScope(principal.Permissions, mapping.Permissions, false)
+		principal.Recipients = mergeScope(principal.Recipients, mapping.Recipients, true)
+		principal.Platforms = mergeScope(principal.Platforms, mapping.Platforms, true)
+	}
+
+	return principal, nil
+}
+
+// lookupJWTKey 根据令牌头部的kid查找验证公钥
+func lookupJWTKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if key, exists := staticJWTKeys[kid]; exists {
+		return key, nil
+	}
+	// 未指定kid且只有一个静态公钥时直接使用
+	if kid == "" && len(staticJWTKeys) == 1 && config.AppConfig.Auth.JWT.JWKSURL == "" {
+		for _, key := range staticJWTKeys {
+			return key, nil
+		}
+	}
+
+	if config.AppConfig.Auth.JWT.JWKSURL != "" {
+		return jwks.get(kid)
+	}
+	return nil, fmt.Errorf("未找到kid为%q的公钥", kid)
+}
+
+// claimValue 获取声明值，path支持以"."分隔的嵌套路径
+func claimValue(claims jwt.MapClaims, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// claimStrings 将声明值转换为字符串列表，字符串按空格分隔
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// mergeScope 合并多个角色的范围，unrestrictedOnEmpty为true时空列表视为不限制
+func mergeScope(current, add []string, unrestrictedOnEmpty bool) []string {
+	if containsString(current, wildcard) {
+		return current
+	}
+	if containsString(add, wildcard) || (unrestrictedOnEmpty && len(add) == 0) {
+		return []string{wildcard}
+	}
+	for _, item := range add {
+		if !containsString(current, item) {
+			current = append(current, item)
+		}
+	}
+	return current
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePublicKeyPEM 解析PEM格式的公钥或证书
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("不是有效的PEM数据")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+// jwksCache JWKS公钥缓存
+// 拉取在锁外进行，同一时间只有一个拉取请求，其余请求等待其结果
+type jwksCache struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	fetching  chan struct{} // 正在进行的拉取，结束时关闭
+	mutex     sync.Mutex
+}
+
+// jsonWebKey JWKS中的单个公钥
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// get 获取指定kid的公钥
+// 缓存过期时在后台刷新并继续使用缓存中的公钥；缓存为空或kid未知时等待拉取完成
+func (jc *jwksCache) get(kid string) (crypto.PublicKey, error) {
+	refresh := defaultJWKSRefresh
+	if seconds := config.AppConfig.Auth.JWT.JWKSRefresh; seconds > 0 {
+		refresh = time.Duration(seconds) * time.Second
+	}
+
+	jc.mutex.Lock()
+	age := time.Since(jc.fetchedAt)
+	key, known := jc.lookup(kid)
+	if jc.fetching == nil && (jc.keys == nil || age > refresh || (!known && age > minJWKSRefetch)) {
+		// 无论成功与否都更新拉取时间，避免认证服务异常时频繁请求
+		jc.fetchedAt = time.Now()
+		jc.fetching = make(chan struct{})
+		go jc.refresh(jc.fetching)
+	}
+	fetching := jc.fetching
+	jc.mutex.Unlock()
+
+	if known {
+		return key, nil
+	}
+	if fetching != nil {
+		<-fetching
+		jc.mutex.Lock()
+		key, known = jc.lookup(kid)
+		empty := jc.keys == nil
+		jc.mutex.Unlock()
+		if known {
+			return key, nil
+		}
+		if empty {
+			return nil, errors.New("拉取JWKS失败")
+		}
+	}
+	return nil, fmt.Errorf("JWKS中未找到kid为%q的公钥", kid)
+}
+
+// lookup 查找缓存中的公钥，调用方需持有锁
+func (jc *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	if key, exists := jc.keys[kid]; exists {
+		return key, true
+	}
+	if kid == "" && len(jc.keys) == 1 {
+		for _, key := range jc.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// refresh 拉取JWKS并替换缓存，失败时保留原有公钥
+func (jc *jwksCache) refresh(done chan struct{}) {
+	keys, err := jc.fetch()
+	if err != nil {
+		logger.Errorf("拉取JWKS失败: %v", err)
+	}
+
+	jc.mutex.Lock()
+	if err == nil {
+		jc.keys = keys
+	}
+	jc.fetching = nil
+	jc.mutex.Unlock()
+	close(done)
+}
+
+// fetch 拉取并解析JWKS
+func (jc *jwksCache) fetch() (map[string]crypto.PublicKey, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(config.AppConfig.Auth.JWT.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("解析JWKS失败: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			logger.Warnf("忽略JWKS公钥 %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	logger.Debugf("JWKS已刷新，公钥数量: %d", len(keys))
+	return keys, nil
+}
+
+// publicKey 将JWK转换为公钥
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("无效的RSA指数")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("坐标不在曲线上")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %s", jwk.Kty)
+	}
+}
+
+// decodeBigInt 解码base64url编码的大整数
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+const (
+	testIssuer   = "https://idp.example.com/realms/ops"
+	testAudience = "push-server"
+)
+
+// jwksStub 模拟身份提供方的JWKS接口，可在测试中轮换公钥并统计请求次数
+type jwksStub struct {
+	mutex    sync.Mutex
+	keys     []map[string]string
+	requests atomic.Int32
+	delay    time.Duration
+}
+
+func (s *jwksStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	time.Sleep(s.delay)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+}
+
+// setKeys 替换JWKS中的公钥
+func (s *jwksStub) setKeys(keys ...map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = keys
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": key.Curve.Params().Name,
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// setupJWT 启动JWKS桩服务并加载JWT配置
+func setupJWT(t *testing.T, stub *jwksStub) {
+	t.Helper()
+	logger.Logger = logrus.New()
+	logger.Logger.SetOutput(io.Discard)
+
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+	config.AppConfig = &config.Config{
+		Auth: config.AuthConfig{
+			Enabled: true,
+			JWT: config.JWTConfig{
+				Enabled:   true,
+				Issuer:    testIssuer,
+				Audience:  testAudience,
+				JWKSURL:   server.URL + "/protocol/openid-connect/certs",
+				RoleClaim: "realm_access.roles",
+				RoleMapping: []config.JWTRoleMapping{
+					{Role: "pusher", Permissions: []string{PermissionPush}, Recipients: []string{"ops_alert"}, Platforms: []string{"dingtalk"}},
+					{Role: "viewer", Permissions: []string{PermissionRead}},
+					{Role: "operator", Permissions: []string{PermissionAdmin}},
+				},
+			},
+		},
+	}
+	loadJWT()
+}
+
+// validClaims 返回可以通过校验的声明
+func validClaims(roles ...string) jwt.MapClaims {
+	now := time.Now()
+	list := make([]interface{}, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, role)
+	}
+	return jwt.MapClaims{
+		"iss":          testIssuer,
+		"aud":          testAudience,
+		"sub":          "svc-alertmanager",
+		"iat":          now.Unix(),
+		"nbf":          now.Add(-time.Minute).Unix(),
+		"exp":          now.Add(time.Hour).Unix(),
+		"realm_access": map[string]interface{}{"roles": list},
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func generateRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAuthenticateJWTAcceptsValidTokens(t *testing.T) {
+	rsaKey := generateRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &jwksStub{}
+	stub.setKeys(rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey))
+	setupJWT(t, stub)
+
+	tokens := map[string]string{
+		"RS256": signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims("pusher")),
+		"PS256": signToken(t, jwt.SigningMethodPS256, "rsa-1", rsaKey, validClaims("pusher")),
+		"ES256": signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, validClaims("pusher")),
+	}
+	for name, token := range tokens {
+		principal, err := AuthenticateJWT(token)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if principal.Method != MethodJWT || principal.Name != "svc-alertmanager" {
+			t.Errorf("%s: principal = %+v", name, principal)
+		}
+	}
+	if got := stub.requests.Load(); got != 1 {
+		t.Errorf("JWKS requests = %d, want 1 (cached after first fetch)", got)
+	}
+}
+
+func TestAuthenticateJWTRejectsInvalidTokens(t *testing.T) {
+	key := generateRSAKey(t)
+	otherKey := generateRSAKey(t)
+	stub := &jwksStub{}
+	stub.setKeys(rsaJWK("rsa-1", key))
+	setupJWT(t, stub)
+
+	with := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		claims := validClaims("pusher")
+		change(claims)
+		return claims
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", signToken(t, jwt.SigningMethodRS256, "rsa-1", key, with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }))},
+		{"missing exp", signToken(t, jwt.SigningMethodRS256, "rsa-1", key, with(func(c jwt.MapClaims) { delete(c, "exp") }))},
+		{"not yet valid", signToken(t, jwt.SigningMethodRS256, "rsa-1", key, with(func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }))},
+		{"wrong issuer", signToken(t, jwt.SigningMethodRS256, "rsa-1", key, with(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }))},
+		{"wrong audience", signToken(t, jwt.SigningMethodRS256, "rsa-1", key, with(func(c jwt.MapClaims) { c["aud"] = "another-service" }))},
+		{"missing subject", signToken(t, jwt.SigningMethodRS256, "rsa-1", key, with(func(c jwt.MapClaims) { delete(c, "sub") }))},
+		{"signed by another key", signToken(t, jwt.SigningMethodRS256, "rsa-1", otherKey, validClaims("pusher"))},
+		{"unknown kid", signToken(t, jwt.SigningMethodRS256, "rsa-2", otherKey, validClaims("pusher"))},
+		{"HS256 not allowed", signToken(t, jwt.SigningMethodHS256, "rsa-1", []byte("shared-secret"), validClaims("pusher"))},
+		{"tampered payload", tamperPayload(t, signToken(t, jwt.SigningMethodRS256, "rsa-1", key, validClaims("viewer")))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if principal, err := AuthenticateJWT(tt.token); err == nil {
+				t.Fatalf("token accepted: %+v", principal)
+			}
+		})
+	}
+}
+
+// tamperPayload 把令牌中的viewer角色改为operator，签名保持不变
+func tamperPayload(t *testing.T, token string) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), "viewer", "operator", 1)))
+	return strings.Join(parts, ".")
+}
+
+func TestAuthenticateJWTLeeway(t *testing.T) {
+	key := generateRSAKey(t)
+	stub := &jwksStub{}
+	stub.setKeys(rsaJWK("rsa-1", key))
+	setupJWT(t, stub)
+	config.AppConfig.Auth.JWT.Leeway = 60
+
+	claims := validClaims("viewer")
+	claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	if _, err := AuthenticateJWT(signToken(t, jwt.SigningMethodRS256, "rsa-1", key, claims)); err != nil {
+		t.Errorf("token expired within leeway rejected: %v", err)
+	}
+}
+
+func TestAuthenticateJWTRefreshesOnUnknownKid(t *testing.T) {
+	oldKey := generateRSAKey(t)
+	newKey := generateRSAKey(t)
+	stub := &jwksStub{}
+	stub.setKeys(rsaJWK("old", oldKey))
+	setupJWT(t, stub)
+
+	if _, err := AuthenticateJWT(signToken(t, jwt.SigningMethodRS256, "old", oldKey, validClaims("viewer"))); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	// 身份提供方轮换公钥，刚拉取过时未知kid不会立即触发请求
+	stub.setKeys(rsaJWK("old", oldKey), rsaJWK("new", newKey))
+	newToken := signToken(t, jwt.SigningMethodRS256, "new", newKey, validClaims("viewer"))
+	if _, err := AuthenticateJWT(newToken); err == nil {
+		t.Fatal("unknown kid accepted before refetch interval")
+	}
+	if got := stub.requests.Load(); got != 1 {
+		t.Fatalf("JWKS requests = %d, want 1 within minJWKSRefetch", got)
+	}
+
+	// 超过最小间隔后，未知kid触发一次拉取并等待结果
+	jwks.mutex.Lock()
+	jwks.fetchedAt = time.Now().Add(-2 * minJWKSRefetch)
+	jwks.mutex.Unlock()
+	if _, err := AuthenticateJWT(newToken); err != nil {
+		t.Fatalf("rotated key rejected after refresh: %v", err)
+	}
+	if got := stub.requests.Load(); got != 2 {
+		t.Errorf("JWKS requests = %d, want 2", got)
+	}
+
+	// 仍然未知的kid不会在最小间隔内反复请求JWKS
+	for i := 0; i < 3; i++ {
+		AuthenticateJWT(signToken(t, jwt.SigningMethodRS256, "missing", newKey, validClaims("viewer")))
+	}
+	if got := stub.requests.Load(); got != 2 {
+		t.Errorf("JWKS requests = %d after repeated unknown kids, want 2", got)
+	}
+}
+
+func TestAuthenticateJWTSingleFlightFetch(t *testing.T) {
+	key := generateRSAKey(t)
+	stub := &jwksStub{delay: 100 * time.Millisecond}
+	stub.setKeys(rsaJWK("rsa-1", key))
+	setupJWT(t, stub)
+
+	token := signToken(t, jwt.SigningMethodRS256, "rsa-1", key, validClaims("viewer"))
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := AuthenticateJWT(token); err != nil {
+				failures.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failures.Load() != 0 {
+		t.Errorf("%d concurrent requests failed", failures.Load())
+	}
+	if got := stub.requests.Load(); got != 1 {
+		t.Errorf("JWKS requests = %d, want 1 for concurrent cold start", got)
+	}
+}
+
+func TestAuthenticateJWTRoleMapping(t *testing.T) {
+	key := generateRSAKey(t)
+	stub := &jwksStub{}
+	stub.setKeys(rsaJWK("rsa-1", key))
+	setupJWT(t, stub)
+
+	tests := []struct {
+		name        string
+		roles       []string
+		permissions []string
+		recipients  []string
+		platforms   []string
+		canRead     bool
+		canAdmin    bool
+	}{
+		{name: "no roles", canRead: false},
+		{name: "unmapped role", roles: []string{"guest"}},
+		{name: "viewer", roles: []string{"viewer"}, permissions: []string{PermissionRead}, recipients: []string{wildcard}, platforms: []string{wildcard}, canRead: true},
+		{name: "pusher", roles: []string{"pusher"}, permissions: []string{PermissionPush}, recipients: []string{"ops_alert"}, platforms: []string{"dingtalk"}},
+		{name: "operator", roles: []string{"operator"}, permissions: []string{PermissionAdmin}, recipients: []string{wildcard}, platforms: []string{wildcard}, canRead: true, canAdmin: true},
+		// 多个角色的权限合并，不限制范围的角色放开接收者和平台
+		{name: "pusher and viewer", roles: []string{"pusher", "viewer"}, permissions: []string{PermissionPush, PermissionRead}, recipients: []string{wildcard}, platforms: []string{wildcard}, canRead: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := AuthenticateJWT(signToken(t, jwt.SigningMethodRS256, "rsa-1", key, validClaims(tt.roles...)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(principal.Permissions, tt.permissions) {
+				t.Errorf("permissions = %v, want %v", principal.Permissions, tt.permissions)
+			}
+			if !reflect.DeepEqual(principal.Recipients, tt.recipients) {
+				t.Errorf("recipients = %v, want %v", principal.Recipients, tt.recipients)
+			}
+			if !reflect.DeepEqual(principal.Platforms, tt.platforms) {
+				t.Errorf("platforms = %v, want %v", principal.Platforms, tt.platforms)
+			}
+			if got := principal.HasPermission(PermissionRead); got != tt.canRead {
+				t.Errorf("HasPermission(read) = %v, want %v", got, tt.canRead)
+			}
+			if got := principal.HasPermission(PermissionAdmin); got != tt.canAdmin {
+				t.Errorf("HasPermission(admin) = %v, want %v", got, tt.canAdmin)
+			}
+		})
+	}
+}
+
+func TestAuthenticateJWTSpaceSeparatedRoleClaim(t *testing.T) {
+	key := generateRSAKey(t)
+	stub := &jwksStub{}
+	stub.setKeys(rsaJWK("rsa-1", key))
+	setupJWT(t, stub)
+	config.AppConfig.Auth.JWT.RoleClaim = "scope"
+
+	claims := validClaims()
+	claims["scope"] = "openid viewer"
+	principal, err := AuthenticateJWT(signToken(t, jwt.SigningMethodRS256, "rsa-1", key, claims))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !principal.HasPermission(PermissionRead) || principal.HasPermission(PermissionPush) {
+		t.Errorf("permissions = %v, want read only", principal.Permissions)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"PushServer/internal/config"
+)
+
+// MethodMTLS 客户端证书认证
+const MethodMTLS = "mtls"
+
+// AuthenticateCertificate 根据已校验的客户端证书的CN或SAN匹配权限
+func AuthenticateCertificate(cert *x509.Certificate) (*Principal, bool) {
+	for _, certConfig := range config.AppConfig.Auth.ClientCerts {
+		if !matchCertificate(cert, certConfig) {
+			continue
+		}
+
+		name := certConfig.Name
+		if name == "" {
+			name = cert.Subject.CommonName
+		}
+		return &Principal{
+			Method:      MethodMTLS,
+			Name:        name,
+			Recipients:  certConfig.Recipients,
+			Platforms:   certConfig.Platforms,
+			Permissions: certConfig.Permissions,
+		}, true
+	}
+	return nil, false
+}
+
+// matchCertificate 检查证书是否匹配映射规则，同时配置cn和san时需要都匹配
+func matchCertificate(cert *x509.Certificate, certConfig config.ClientCertConfig) bool {
+	if certConfig.CommonName == "" && certConfig.SAN == "" {
+		return false
+	}
+	if certConfig.CommonName != "" && cert.Subject.CommonName != certConfig.CommonName {
+		return false
+	}
+	if certConfig.SAN != "" && !matchSAN(cert, certConfig.SAN) {
+		return false
+	}
+	return true
+}
+
+// matchSAN 匹配DNS、邮箱或URI形式的SAN
+func matchSAN(cert *x509.Certificate, san string) bool {
+	for _, dnsName := range cert.DNSNames {
+		if matchDNSName(dnsName, san) {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if strings.EqualFold(email, san) {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDNSName 匹配DNS名称，pattern支持*.example.com形式的单级通配
+func matchDNSName(name, pattern string) bool {
+	name = strings.ToLower(name)
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return strings.HasSuffix(name, suffix) && !strings.Contains(strings.TrimSuffix(name, suffix), ".")
+	}
+	return name == pattern
+}
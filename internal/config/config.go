@@ -15,13 +15,61 @@ type Config struct {
 	Email      EmailConfig                `mapstructure:"email"`
 	SMTPRelay  SMTPRelayConfig            `mapstructure:"smtp_relay"`
 	System     SystemConfig               `mapstructure:"system"`
+	Tracing    TracingConfig              `mapstructure:"tracing"`
+	Statistics StatisticsConfig           `mapstructure:"statistics"`
+	Health     HealthConfig               `mapstructure:"health"`
+	Auth       AuthConfig                 `mapstructure:"auth"`
+	RateLimit  RateLimitConfig            `mapstructure:"rate_limit"`
+	Redaction  RedactionConfig            `mapstructure:"redaction"`
+	Audit      AuditConfig                `mapstructure:"audit"`
+	DKIM       DKIMConfig                 `mapstructure:"dkim"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
-	Mode string `mapstructure:"mode"`
+	Port           int            `mapstructure:"port"`
+	Host           string         `mapstructure:"host"`
+	Mode           string         `mapstructure:"mode"`
+	TrustedProxies []string       `mapstructure:"trusted_proxies"` // 可信代理IP/CIDR，为空表示不信任X-Forwarded-For
+	CORS           CORSConfig     `mapstructure:"cors"`
+	IPFilter       IPFilterConfig `mapstructure:"ip_filter"`
+	TLS            HTTPTLSConfig  `mapstructure:"tls"`
+}
+
+// HTTPTLSConfig HTTPS配置
+type HTTPTLSConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Port           int    `mapstructure:"port"`            // HTTPS端口
+	ServeHTTP      bool   `mapstructure:"serve_http"`      // 启用HTTPS时是否同时在server.port提供HTTP服务
+	CertFile       string `mapstructure:"cert_file"`       // 证书文件(PEM，可包含中间证书)
+	KeyFile        string `mapstructure:"key_file"`        // 私钥文件(PEM)
+	ReloadInterval int    `mapstructure:"reload_interval"` // 检查证书文件变化的间隔(秒)
+	MinVersion     string `mapstructure:"min_version"`     // 最低TLS版本: 1.2, 1.3
+	ClientAuth     string `mapstructure:"client_auth"`     // 客户端证书校验: none, optional, require
+	ClientCAFile   string `mapstructure:"client_ca_file"`  // 校验客户端证书的CA文件
+}
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	AllowedOrigins   []string `mapstructure:"allowed_origins"` // 允许的来源，"*"表示任意来源(此时不允许携带凭证)
+	AllowedMethods   []string `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string `mapstructure:"exposed_headers"`
+	AllowCredentials bool     `mapstructure:"allow_credentials"`
+	MaxAge           int      `mapstructure:"max_age"` // 预检结果缓存时间(秒)
+}
+
+// IPFilterConfig 各路由组的IP访问控制配置
+type IPFilterConfig struct {
+	Push          IPRuleConfig `mapstructure:"push"`
+	Notifications IPRuleConfig `mapstructure:"notifications"`
+	SMTPRelay     IPRuleConfig `mapstructure:"smtp_relay"`
+}
+
+// IPRuleConfig IP访问控制规则，deny优先，allow为空表示不限制
+type IPRuleConfig struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
 }
 
 // LogConfig 日志配置
@@ -69,6 +117,8 @@ type QueueConfig struct {
 	Timeout                  int `mapstructure:"timeout"`                     // 推送超时时间(秒)
 	MaxConcurrentPerPlatform int `mapstructure:"max_concurrent_per_platform"` // 每个平台最大并发数
 	BatchSize                int `mapstructure:"batch_size"`                  // 批处理大小
+	EnqueueWait              int `mapstructure:"enqueue_wait"`                // 队列满时默认入队等待时间(毫秒)，0表示立即失败
+	MaxEnqueueWait           int `mapstructure:"max_enqueue_wait"`            // 调用方可请求的最大入队等待时间(毫秒)，0表示不超过EnqueueWait
 }
 
 // TaskConfig 任务状态配置
@@ -86,36 +136,117 @@ type EmailConfig struct {
 	From     string `mapstructure:"from"`
 }
 
+// DKIMConfig DKIM签名配置，对中继转发和邮件平台发出的邮件按From域名签名
+type DKIMConfig struct {
+	Enabled bool               `mapstructure:"enabled"`
+	Domains []DKIMDomainConfig `mapstructure:"domains"`
+}
+
+// DKIMDomainConfig 单个签名域名的配置
+type DKIMDomainConfig struct {
+	Domain         string   `mapstructure:"domain"`           // 签名域名(d=)，From为该域名或其子域名时签名
+	Selector       string   `mapstructure:"selector"`         // 选择器(s=)，公钥发布在<selector>._domainkey.<domain>
+	PrivateKeyFile string   `mapstructure:"private_key_file"` // PEM格式私钥文件，支持RSA和Ed25519
+	PrivateKey     string   `mapstructure:"private_key"`      // PEM格式私钥内容，可使用enc:或vault:引用，与private_key_file二选一
+	Headers        []string `mapstructure:"headers"`          // 参与签名的邮件头，为空时使用默认列表
+}
+
 // SMTPRelayConfig SMTP中继配置
 type SMTPRelayConfig struct {
-	Enabled    bool                `mapstructure:"enabled"`
-	MaxRetries int                 `mapstructure:"max_retries"`
-	Server     SMTPServerConfig    `mapstructure:"server"`
-	Auth       SMTPAuthConfig      `mapstructure:"auth"`
-	Accounts   []SMTPAccountConfig `mapstructure:"accounts"`
+	Enabled        bool                    `mapstructure:"enabled"`
+	MaxRetries     int                     `mapstructure:"max_retries"`
+	MaxMessageSize int                     `mapstructure:"max_message_size"` // 单封邮件最大字节数，通过EHLO SIZE公布，默认25MB，0表示不限制
+	Mode           string                  `mapstructure:"mode"`             // 转发模式: rebuild(重新构建邮件，默认), passthrough(原样转发DATA内容)
+	Server         SMTPServerConfig        `mapstructure:"server"`
+	TLS            SMTPRelayTLSConfig      `mapstructure:"tls"`
+	Users          []SMTPRelayUserConfig   `mapstructure:"users"`
+	Accounts       []SMTPAccountConfig     `mapstructure:"accounts"`
+	AccountHealth  SMTPAccountHealthConfig `mapstructure:"account_health"`
+	Routes         []SMTPRouteConfig       `mapstructure:"routes"` // 按收件人域名和发件人选择账户，按顺序匹配，未匹配的收件人使用所有账户
+	Spool          SMTPSpoolConfig         `mapstructure:"spool"`
+	Bridge         SMTPBridgeConfig        `mapstructure:"bridge"`
+}
+
+// SMTPRouteConfig SMTP中继路由规则，条件都满足时收件人通过指定账户投递
+type SMTPRouteConfig struct {
+	Name             string   `mapstructure:"name"`
+	RecipientDomains []string `mapstructure:"recipient_domains"` // 收件人域名，支持*.example.com，为空表示任意域名
+	Senders          []string `mapstructure:"senders"`           // 信封发件人地址或域名，为空表示任意发件人
+	Accounts         []string `mapstructure:"accounts"`          // 使用的账户名称
+}
+
+// SMTPAccountHealthConfig 账户健康检查配置，连续连接或认证失败的账户暂时停用
+type SMTPAccountHealthConfig struct {
+	FailureThreshold int `mapstructure:"failure_threshold"` // 连续失败多少次后停用，默认3
+	Cooldown         int `mapstructure:"cooldown"`          // 停用时长(秒)，默认300
+}
+
+// SMTPBridgeConfig 邮件转IM桥接配置，发往<接收者别名>@<domain>的邮件转换为推送请求
+type SMTPBridgeConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Domain          string `mapstructure:"domain"`           // 桥接域名
+	DefaultType     string `mapstructure:"default_type"`     // 未携带X-Push-Type时的消息类型
+	DefaultStrategy string `mapstructure:"default_strategy"` // 未携带X-Push-Strategy时的发送策略
+	DefaultStyle    string `mapstructure:"default_style"`    // 未携带X-Push-Style时的消息样式
+}
+
+// SMTPSpoolConfig SMTP中继本地队列配置
+type SMTPSpoolConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Dir           string `mapstructure:"dir"`            // 队列目录
+	RetrySchedule []int  `mapstructure:"retry_schedule"` // 各次重试的等待时间(秒)，超出后沿用最后一个值
+	Lifetime      int    `mapstructure:"lifetime"`       // 邮件在队列中的最长保留时间(秒)，超过后放弃投递
+	ScanInterval  int    `mapstructure:"scan_interval"`  // 检查到期邮件的间隔(秒)
 }
 
 // SMTPServerConfig SMTP服务器配置
 type SMTPServerConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host             string `mapstructure:"host"`
+	Port             int    `mapstructure:"port"`
+	MaxConnections   int    `mapstructure:"max_connections"`    // 最大并发连接数，默认100，0表示不限制
+	IdleTimeout      int    `mapstructure:"idle_timeout"`       // 等待客户端命令的空闲超时(秒)，默认300，0表示不限制
+	MaxCommandLength int    `mapstructure:"max_command_length"` // 命令行最大长度(含CRLF)，默认512，AUTH命令最长12288
+	MaxLineLength    int    `mapstructure:"max_line_length"`    // DATA内容行最大长度(含CRLF)，默认1MB
+	MaxRecipients    int    `mapstructure:"max_recipients"`     // 每封邮件最大收件人数，默认100，0表示不限制
 }
 
-// SMTPAuthConfig SMTP认证配置
-type SMTPAuthConfig struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+// SMTPRelayTLSConfig SMTP中继监听的TLS配置
+type SMTPRelayTLSConfig struct {
+	CertFile       string `mapstructure:"cert_file"`       // 证书文件，配置后支持STARTTLS
+	KeyFile        string `mapstructure:"key_file"`        // 私钥文件
+	ReloadInterval int    `mapstructure:"reload_interval"` // 检查证书文件变化的间隔(秒)
+	MinVersion     string `mapstructure:"min_version"`     // 最低TLS版本: 1.2, 1.3
+	ImplicitPort   int    `mapstructure:"implicit_port"`   // 隐式TLS(SMTPS)端口，如465，0表示不启用
+	RequireTLS     bool   `mapstructure:"require_tls"`     // 是否要求在AUTH之前完成TLS
+}
+
+// SMTPRelayUserConfig SMTP中继用户配置
+type SMTPRelayUserConfig struct {
+	Username     string `mapstructure:"username"`
+	PasswordHash string `mapstructure:"password_hash"` // bcrypt哈希，可通过 PushServer hash-password 生成
+	Password     string `mapstructure:"password"`      // 明文密码，仅在需要CRAM-MD5时配置，建议使用enc:加密
+
+	AllowedSenders          []string `mapstructure:"allowed_senders"`           // 允许的发件人地址或域名，为空表示不限制
+	AllowedRecipientDomains []string `mapstructure:"allowed_recipient_domains"` // 允许的收件人域名，为空表示不限制
+	AllowedAliases          []string `mapstructure:"allowed_aliases"`           // 桥接时允许推送的接收者别名，为空时按allowed_recipient_domains检查桥接地址
+	MaxRecipients           int      `mapstructure:"max_recipients"`            // 每封邮件的最大收件人数，0表示不限制
+	MaxMessageSize          int      `mapstructure:"max_message_size"`          // 单封邮件最大字节数，0表示使用全局限制
+	DailyQuota              int      `mapstructure:"daily_quota"`               // 每天最多提交的收件人数，0表示不限制
 }
 
 // SMTPAccountConfig SMTP账户配置
 type SMTPAccountConfig struct {
-	Name     string `mapstructure:"name"`
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
-	From     string `mapstructure:"from"`
-	Enabled  bool   `mapstructure:"enabled"`
+	Name       string `mapstructure:"name"`
+	Host       string `mapstructure:"host"`
+	Port       int    `mapstructure:"port"`
+	Username   string `mapstructure:"username"`
+	Password   string `mapstructure:"password"`
+	From       string `mapstructure:"from"`
+	Enabled    bool   `mapstructure:"enabled"`
+	FromPolicy string `mapstructure:"from_policy"` // passthrough模式下From头的处理: keep(保留，默认), rewrite(改写为账户地址)
+	Weight     int    `mapstructure:"weight"`      // 选择账户时的权重，默认1
+	DailyLimit int    `mapstructure:"daily_limit"` // 每天最多投递的收件人数，0表示不限制
+	Timeout    int    `mapstructure:"timeout"`     // 连接和等待服务器响应的超时(秒)，默认60
 }
 
 // SystemConfig 系统通知配置
@@ -131,6 +262,143 @@ type SystemNotificationConfig struct {
 	URL  string `mapstructure:"url"`
 }
 
+// AuthConfig 接口认证配置
+type AuthConfig struct {
+	Enabled      bool               `mapstructure:"enabled"`
+	APIKeys      []APIKeyConfig     `mapstructure:"api_keys"`
+	HMAC         HMACConfig         `mapstructure:"hmac"`
+	JWT          JWTConfig          `mapstructure:"jwt"`
+	ClientCerts  []ClientCertConfig `mapstructure:"client_certs"`  // mTLS客户端证书到权限的映射
+	AdminMethods []string           `mapstructure:"admin_methods"` // 允许使用admin权限的认证方式，为空时只允许jwt，"*"表示不限制
+}
+
+// ClientCertConfig mTLS客户端证书映射，按CN或SAN匹配
+type ClientCertConfig struct {
+	Name        string   `mapstructure:"name"`
+	CommonName  string   `mapstructure:"cn"`  // 证书主题CN
+	SAN         string   `mapstructure:"san"` // DNS、邮箱或URI形式的SAN，支持*.example.com
+	Recipients  []string `mapstructure:"recipients"`
+	Platforms   []string `mapstructure:"platforms"`
+	Permissions []string `mapstructure:"permissions"`
+}
+
+// APIKeyConfig API密钥配置
+type APIKeyConfig struct {
+	Name        string   `mapstructure:"name"`        // 密钥名称，记录在任务中
+	Key         string   `mapstructure:"key"`         // 明文密钥，推荐使用key_hash
+	KeyHash     string   `mapstructure:"key_hash"`    // 密钥的SHA-256十六进制摘要
+	Recipients  []string `mapstructure:"recipients"`  // 允许推送的接收者别名，为空或"*"表示不限制
+	Platforms   []string `mapstructure:"platforms"`   // 允许指定的推送平台，为空或"*"表示不限制
+	Permissions []string `mapstructure:"permissions"` // 权限: push, read, admin
+}
+
+// HMACConfig HMAC请求签名配置
+type HMACConfig struct {
+	MaxSkew int                `mapstructure:"max_skew"` // 允许的时钟偏差(秒)
+	Clients []HMACClientConfig `mapstructure:"clients"`
+}
+
+// HMACClientConfig HMAC签名调用方配置
+type HMACClientConfig struct {
+	Name        string   `mapstructure:"name"`        // 调用方名称，记录在任务中
+	KeyID       string   `mapstructure:"key_id"`      // 密钥ID，通过X-Push-Key-Id请求头传递
+	Secret      string   `mapstructure:"secret"`      // 签名密钥
+	Recipients  []string `mapstructure:"recipients"`  // 允许推送的接收者别名，为空或"*"表示不限制
+	Platforms   []string `mapstructure:"platforms"`   // 允许指定的推送平台，为空或"*"表示不限制
+	Permissions []string `mapstructure:"permissions"` // 权限: push, read, admin
+}
+
+// JWTConfig JWT/OIDC认证配置
+type JWTConfig struct {
+	Enabled      bool                 `mapstructure:"enabled"`
+	Issuer       string               `mapstructure:"issuer"`        // 期望的iss，为空表示不校验
+	Audience     string               `mapstructure:"audience"`      // 期望的aud，为空表示不校验
+	JWKSURL      string               `mapstructure:"jwks_url"`      // JWKS地址
+	JWKSRefresh  int                  `mapstructure:"jwks_refresh"`  // JWKS刷新间隔(秒)
+	StaticKeys   []JWTStaticKeyConfig `mapstructure:"static_keys"`   // 静态公钥，与JWKS可同时使用
+	Algorithms   []string             `mapstructure:"algorithms"`    // 允许的签名算法
+	Leeway       int                  `mapstructure:"leeway"`        // 时间校验容差(秒)
+	SubjectClaim string               `mapstructure:"subject_claim"` // 作为调用方名称的声明，默认sub
+	RoleClaim    string               `mapstructure:"role_claim"`    // 角色声明，支持嵌套路径，如realm_access.roles
+	RoleMapping  []JWTRoleMapping     `mapstructure:"role_mapping"`  // 角色到权限的映射
+}
+
+// JWTStaticKeyConfig JWT静态公钥配置
+type JWTStaticKeyConfig struct {
+	KeyID     string `mapstructure:"kid"`
+	PublicKey string `mapstructure:"public_key"` // PEM格式公钥
+	File      string `mapstructure:"file"`       // PEM公钥文件路径
+}
+
+// JWTRoleMapping JWT角色映射
+type JWTRoleMapping struct {
+	Role        string   `mapstructure:"role"`
+	Permissions []string `mapstructure:"permissions"`
+	Recipients  []string `mapstructure:"recipients"`
+	Platforms   []string `mapstructure:"platforms"`
+}
+
+// RateLimitConfig 推送接口限流配置
+type RateLimitConfig struct {
+	Enabled      bool                `mapstructure:"enabled"`
+	PerKey       RateLimitRule       `mapstructure:"per_key"`       // 每个调用方(API密钥/HMAC/JWT)
+	PerIP        RateLimitRule       `mapstructure:"per_ip"`        // 每个来源IP
+	PerRecipient RateLimitRule       `mapstructure:"per_recipient"` // 每个接收者别名
+	Overrides    []RateLimitOverride `mapstructure:"overrides"`
+	IdleTimeout  int                 `mapstructure:"idle_timeout"` // 空闲令牌桶清理时间(秒)
+}
+
+// RateLimitRule 令牌桶限流规则，rate为0表示不限制
+type RateLimitRule struct {
+	Rate  float64 `mapstructure:"rate"`  // 每秒补充的令牌数
+	Burst int     `mapstructure:"burst"` // 桶容量，即允许的突发请求数
+}
+
+// RateLimitOverride 针对单个调用方、IP或接收者的限流覆盖
+type RateLimitOverride struct {
+	Dimension string  `mapstructure:"dimension"` // key, ip, recipient
+	Key       string  `mapstructure:"key"`       // 调用方标识(如api_key:ops-script)、IP或接收者别名
+	Rate      float64 `mapstructure:"rate"`
+	Burst     int     `mapstructure:"burst"`
+}
+
+// RedactionConfig 日志和接口响应的脱敏配置
+type RedactionConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	QueryParams []string `mapstructure:"query_params"` // 需要脱敏的URL查询参数
+	Fields      []string `mapstructure:"fields"`       // 需要脱敏的字段名(JSON字段和key=value)
+	MaskEmails  bool     `mapstructure:"mask_emails"`  // 是否脱敏邮箱地址
+	MaskHosts   bool     `mapstructure:"mask_hosts"`   // 是否在接口响应中脱敏SMTP主机名
+	Patterns    []string `mapstructure:"patterns"`     // 额外的脱敏正则，匹配内容整体替换为***
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	FilePath string `mapstructure:"file_path"` // 审计日志文件，JSON Lines格式，只追加
+}
+
+// HealthConfig 健康检查配置
+type HealthConfig struct {
+	QueueSaturationThreshold float64 `mapstructure:"queue_saturation_threshold"` // 队列饱和度告警阈值(0-1)
+	CheckWebhooks            bool    `mapstructure:"check_webhooks"`             // 是否检查webhook主机可达性
+	Timeout                  int     `mapstructure:"timeout"`                    // 单项检查超时时间(毫秒)
+}
+
+// StatisticsConfig 投递统计配置
+type StatisticsConfig struct {
+	Retention int `mapstructure:"retention"` // 汇总数据保留时长(小时)
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	Endpoint    string            `mapstructure:"endpoint"`     // OTLP/HTTP接收地址，如 http://localhost:4318
+	ServiceName string            `mapstructure:"service_name"` // 上报的服务名
+	SampleRatio float64           `mapstructure:"sample_ratio"` // 采样率(0-1]
+	Headers     map[string]string `mapstructure:"headers"`      // 导出时附加的请求头
+}
+
 var AppConfig *Config
 
 // LoadConfig 加载配置文件
@@ -142,6 +410,16 @@ func LoadConfig(configPath string) error {
 	viper.SetEnvPrefix("PUSH_SERVER")
 	viper.AutomaticEnv()
 
+	// 默认开启脱敏
+	viper.SetDefault("redaction.enabled", true)
+	viper.SetDefault("redaction.mask_emails", true)
+
+	// SMTP中继默认限制单封邮件25MB、并发连接数和空闲时间，避免客户端无限占用资源
+	viper.SetDefault("smtp_relay.max_message_size", 25*1024*1024)
+	viper.SetDefault("smtp_relay.server.max_connections", 100)
+	viper.SetDefault("smtp_relay.server.idle_timeout", 300)
+	viper.SetDefault("smtp_relay.server.max_recipients", 100)
+
 	// 读取配置文件
 	if err := viper.ReadInConfig(); err != nil {
 		return fmt.Errorf("读取配置文件失败 [%s]: %w", configPath, err)
@@ -153,9 +431,46 @@ func LoadConfig(configPath string) error {
 		return fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
+	Deprecations = nil
+	migrateLegacySMTPAuth(AppConfig)
+
+	// 解析${ENV}、file:、vault:和enc:密钥引用
+	if err := resolveSecrets(AppConfig); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// Deprecations 加载配置时发现的已废弃配置项，由调用方在日志初始化后输出
+var Deprecations []string
+
+// migrateLegacySMTPAuth 将旧版的smtp_relay.auth单用户配置转换为smtp_relay.users中的用户
+func migrateLegacySMTPAuth(cfg *Config) {
+	if !viper.IsSet("smtp_relay.auth") {
+		return
+	}
+
+	username := viper.GetString("smtp_relay.auth.username")
+	password := viper.GetString("smtp_relay.auth.password")
+	if username == "" {
+		Deprecations = append(Deprecations, "smtp_relay.auth已废弃且未配置username，已忽略，请改用smtp_relay.users配置中继用户")
+		return
+	}
+	for _, user := range cfg.SMTPRelay.Users {
+		if user.Username == username {
+			Deprecations = append(Deprecations, fmt.Sprintf("smtp_relay.auth已废弃，smtp_relay.users中已有用户 %s，已忽略smtp_relay.auth", username))
+			return
+		}
+	}
+
+	cfg.SMTPRelay.Users = append(cfg.SMTPRelay.Users, SMTPRelayUserConfig{
+		Username: username,
+		Password: password,
+	})
+	Deprecations = append(Deprecations, fmt.Sprintf("smtp_relay.auth已废弃，已按明文密码用户 %s 加载，请改用smtp_relay.users并配置password_hash", username))
+}
+
 // GetServerAddr 获取服务器地址
 func (c *Config) GetServerAddr() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
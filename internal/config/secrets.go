@@ -0,0 +1,310 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 密钥引用前缀
+const (
+	prefixFile      = "file:"
+	prefixVault     = "vault:"
+	prefixEncrypted = "enc:"
+)
+
+// 主密钥环境变量，值为Base64编码的32字节密钥
+const (
+	MasterKeyEnv     = "PUSH_SERVER_MASTER_KEY"
+	MasterKeyFileEnv = "PUSH_SERVER_MASTER_KEY_FILE"
+)
+
+// envPattern 匹配${VAR}和${VAR:-默认值}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// secretResolver 解析配置中的密钥引用，同一次加载内缓存Vault读取结果
+type secretResolver struct {
+	vaultCache map[string]map[string]interface{}
+	masterKey  []byte
+}
+
+// resolveSecrets 递归解析配置结构体中所有字符串字段的密钥引用
+func resolveSecrets(cfg *Config) error {
+	resolver := &secretResolver{vaultCache: make(map[string]map[string]interface{})}
+	return resolver.walk(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// walk 遍历结构体、切片和map中的字符串值
+func (r *secretResolver) walk(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		resolved, err := r.resolve(v.String())
+		if err != nil {
+			return fmt.Errorf("解析配置项 %s 失败: %w", path, err)
+		}
+		v.SetString(resolved)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Tag.Get("mapstructure")
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if err := r.walk(v.Field(i), joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map的值不可寻址，复制后解析再写回
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			if err := r.walk(value, joinPath(path, fmt.Sprint(key.Interface()))); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return r.walk(v.Elem(), path)
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// resolve 解析单个配置值：先展开环境变量，再处理file:、vault:、enc:前缀
+func (r *secretResolver) resolve(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+
+	expanded, err := expandEnv(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(expanded, prefixFile):
+		data, err := os.ReadFile(strings.TrimPrefix(expanded, prefixFile))
+		if err != nil {
+			return "", fmt.Errorf("读取密钥文件失败: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(expanded, prefixVault):
+		return r.readVault(strings.TrimPrefix(expanded, prefixVault))
+	case strings.HasPrefix(expanded, prefixEncrypted):
+		return r.decrypt(strings.TrimPrefix(expanded, prefixEncrypted))
+	}
+	return expanded, nil
+}
+
+// expandEnv 展开${VAR}引用，变量未设置且没有默认值时返回错误
+func expandEnv(value string) (string, error) {
+	var missing []string
+	result := envPattern.ReplaceAllStringFunc(value, func(match string) string {
+		groups := envPattern.FindStringSubmatch(match)
+		if env, exists := os.LookupEnv(groups[1]); exists {
+			return env
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		missing = append(missing, groups[1])
+		return match
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("环境变量未设置: %s", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+// readVault 从Vault KV v2读取密钥，引用格式为 <挂载点>/<路径>#<字段>
+// 服务地址和令牌通过VAULT_ADDR、VAULT_TOKEN环境变量配置
+func (r *secretResolver) readVault(reference string) (string, error) {
+	secretPath, field, found := strings.Cut(reference, "#")
+	if !found || field == "" {
+		return "", errors.New("Vault引用格式应为 vault:<挂载点>/<路径>#<字段>")
+	}
+
+	data, cached := r.vaultCache[secretPath]
+	if !cached {
+		var err error
+		data, err = fetchVaultSecret(secretPath)
+		if err != nil {
+			return "", err
+		}
+		r.vaultCache[secretPath] = data
+	}
+
+	value, exists := data[field]
+	if !exists {
+		return "", fmt.Errorf("Vault密钥 %s 中不存在字段 %s", secretPath, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// fetchVaultSecret 请求Vault KV v2接口
+func fetchVaultSecret(secretPath string) (map[string]interface{}, error) {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("使用vault:引用需要设置VAULT_ADDR和VAULT_TOKEN环境变量")
+	}
+
+	// KV v2的读取路径为 <挂载点>/data/<路径>
+	mount, rest, _ := strings.Cut(strings.Trim(secretPath, "/"), "/")
+	if !strings.HasPrefix(rest, "data/") {
+		rest = "data/" + rest
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/%s/%s", addr, mount, rest), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求Vault失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("读取Vault密钥 %s 失败，HTTP状态码: %d", secretPath, resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析Vault响应失败: %w", err)
+	}
+	return result.Data.Data, nil
+}
+
+// decrypt 解密enc:引用
+func (r *secretResolver) decrypt(ciphertext string) (string, error) {
+	if r.masterKey == nil {
+		key, err := LoadMasterKey()
+		if err != nil {
+			return "", err
+		}
+		r.masterKey = key
+	}
+	return DecryptValue(r.masterKey, ciphertext)
+}
+
+// LoadMasterKey 从环境变量或文件加载主密钥
+func LoadMasterKey() ([]byte, error) {
+	encoded := os.Getenv(MasterKeyEnv)
+	if encoded == "" {
+		if keyFile := os.Getenv(MasterKeyFileEnv); keyFile != "" {
+			data, err := os.ReadFile(keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("读取主密钥文件失败: %w", err)
+			}
+			encoded = string(data)
+		}
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("使用enc:加密值需要设置%s或%s环境变量", MasterKeyEnv, MasterKeyFileEnv)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("主密钥必须是Base64编码的32字节密钥")
+	}
+	return key, nil
+}
+
+// GenerateMasterKey 生成新的Base64编码主密钥
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// EncryptValue 使用AES-256-GCM加密配置值，返回enc:前缀的密文
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefixEncrypted + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue 解密Base64编码的nonce+密文
+func DecryptValue(key []byte, ciphertext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ciphertext))
+	if err != nil {
+		return "", errors.New("加密值不是有效的Base64")
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("加密值长度无效")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("解密失败，主密钥不匹配或密文已损坏")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,334 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+// DefaultHeaders 未配置headers时参与签名的邮件头
+var DefaultHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// Signer 单个域名的DKIM签名器，使用relaxed/relaxed规范化
+type Signer struct {
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+	headers   []string
+}
+
+// signers 已加载的签名器，InitDKIM后只读
+var signers []*Signer
+
+// now 签名时间戳的来源，测试时替换
+var now = time.Now
+
+// InitDKIM 根据配置加载各签名域名的私钥
+func InitDKIM() error {
+	signers = nil
+	if !config.AppConfig.DKIM.Enabled {
+		return nil
+	}
+
+	for _, domainConfig := range config.AppConfig.DKIM.Domains {
+		signer, err := NewSigner(domainConfig)
+		if err != nil {
+			return err
+		}
+		signers = append(signers, signer)
+		logger.Infof("DKIM签名已启用: 域名=%s, 选择器=%s, 算法=%s", signer.domain, signer.selector, signer.algorithm)
+	}
+	return nil
+}
+
+// NewSigner 根据域名配置创建签名器
+func NewSigner(domainConfig config.DKIMDomainConfig) (*Signer, error) {
+	if domainConfig.Domain == "" || domainConfig.Selector == "" {
+		return nil, fmt.Errorf("DKIM配置缺少domain或selector")
+	}
+
+	keyPEM := []byte(domainConfig.PrivateKey)
+	if domainConfig.PrivateKeyFile != "" {
+		data, err := os.ReadFile(domainConfig.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取DKIM私钥失败 [%s]: %v", domainConfig.Domain, err)
+		}
+		keyPEM = data
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析DKIM私钥失败 [%s]: %v", domainConfig.Domain, err)
+	}
+
+	signer := &Signer{
+		domain:   strings.ToLower(domainConfig.Domain),
+		selector: domainConfig.Selector,
+		key:      key,
+		headers:  domainConfig.Headers,
+	}
+	if len(signer.headers) == 0 {
+		signer.headers = DefaultHeaders
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		signer.algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		signer.algorithm = "ed25519-sha256"
+	}
+
+	hasFrom := false
+	for _, name := range signer.headers {
+		if strings.EqualFold(name, "From") {
+			hasFrom = true
+		}
+	}
+	if !hasFrom {
+		return nil, fmt.Errorf("DKIM签名头必须包含From [%s]", domainConfig.Domain)
+	}
+	return signer, nil
+}
+
+// parsePrivateKey 解析PKCS#1或PKCS#8格式的RSA/Ed25519私钥
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("未找到PEM格式私钥")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("不支持的私钥类型: %T", key)
+	}
+}
+
+// Enabled 是否配置了DKIM签名
+func Enabled() bool {
+	return len(signers) > 0
+}
+
+// CanSign 是否配置了该发件地址域名(或其上级域名)的签名器
+func CanSign(address string) bool {
+	return findSigner(address) != nil
+}
+
+// Sign 按邮件From头的域名选择签名器并在邮件开头添加DKIM-Signature头
+// 没有匹配的签名域名时原样返回，返回的邮件行尾统一为CRLF
+func Sign(message []byte) ([]byte, error) {
+	if len(signers) == 0 {
+		return message, nil
+	}
+	message = normalizeNewlines(message)
+	header, _ := splitMessage(message)
+	msg, err := mail.ReadMessage(bytes.NewReader(append(append([]byte{}, header...), '\r', '\n')))
+	if err != nil {
+		return message, fmt.Errorf("解析邮件头失败: %v", err)
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return message, fmt.Errorf("解析From头失败: %v", err)
+	}
+
+	signer := findSigner(from.Address)
+	if signer == nil {
+		return message, nil
+	}
+	return signer.Sign(message)
+}
+
+// findSigner 返回From域名对应的签名器，优先完全匹配，其次为上级域名
+func findSigner(address string) *Signer {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return nil
+	}
+	domain := strings.ToLower(address[at+1:])
+	var matched *Signer
+	for _, signer := range signers {
+		if domain == signer.domain {
+			return signer
+		}
+		if strings.HasSuffix(domain, "."+signer.domain) && (matched == nil || len(signer.domain) > len(matched.domain)) {
+			matched = signer
+		}
+	}
+	return matched
+}
+
+// Sign 对邮件签名，message需以CRLF作为行尾
+func (s *Signer) Sign(message []byte) ([]byte, error) {
+	header, body := splitMessage(message)
+	bodyHash := sha256.Sum256(canonicalBody(body))
+
+	// 按h=列表从下往上选取邮件头，同名邮件头多次出现时依次取更靠上的一个
+	fields := splitHeaderFields(header)
+	used := make([]bool, len(fields))
+	var signedNames []string
+	var signedData bytes.Buffer
+	for _, name := range s.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fieldName(fields[i]), name) {
+				continue
+			}
+			used[i] = true
+			signedNames = append(signedNames, strings.ToLower(name))
+			signedData.WriteString(canonicalHeader(fields[i]))
+			signedData.WriteString("\r\n")
+			break
+		}
+	}
+
+	signature := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d; h=%s;\r\n\tbh=%s;\r\n\tb=",
+		s.algorithm, s.domain, s.selector, now().Unix(),
+		strings.Join(signedNames, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	signedData.WriteString(canonicalHeader(signature))
+
+	digest := sha256.Sum256(signedData.Bytes())
+	var opts crypto.SignerOpts = crypto.SHA256
+	if s.algorithm == "ed25519-sha256" {
+		// RFC 8463: Ed25519对SHA-256摘要做PureEdDSA签名
+		opts = crypto.Hash(0)
+	}
+	sig, err := s.key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return message, fmt.Errorf("DKIM签名失败: %v", err)
+	}
+
+	var signed bytes.Buffer
+	signed.WriteString(signature)
+	signed.WriteString(foldBase64(base64.StdEncoding.EncodeToString(sig)))
+	signed.WriteString("\r\n")
+	signed.Write(message)
+	return signed.Bytes(), nil
+}
+
+// normalizeNewlines 将单独的LF转换为CRLF，与SMTP传输时的行尾保持一致
+func normalizeNewlines(message []byte) []byte {
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(message, []byte("\n"), []byte("\r\n"))
+}
+
+// splitMessage 在第一个空行处拆分邮件头和正文，邮件头不含结尾的空行
+func splitMessage(message []byte) ([]byte, []byte) {
+	if bytes.HasPrefix(message, []byte("\r\n")) {
+		return nil, message[2:]
+	}
+	if index := bytes.Index(message, []byte("\r\n\r\n")); index >= 0 {
+		return message[:index+2], message[index+4:]
+	}
+	return message, nil
+}
+
+// splitHeaderFields 按行拆分邮件头，折叠的续行归入上一个邮件头
+func splitHeaderFields(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSuffix(fields[i], "\r\n")
+	}
+	return fields
+}
+
+// fieldName 返回邮件头名称
+func fieldName(field string) string {
+	if colon := strings.Index(field, ":"); colon >= 0 {
+		return strings.TrimSpace(field[:colon])
+	}
+	return field
+}
+
+// canonicalHeader relaxed规范化邮件头：名称转小写，展开折叠行，连续空白压缩为一个空格，去掉冒号两侧和行尾的空白
+func canonicalHeader(field string) string {
+	colon := strings.Index(field, ":")
+	if colon < 0 {
+		return strings.ToLower(strings.TrimSpace(field)) + ":"
+	}
+	name := strings.ToLower(strings.TrimSpace(field[:colon]))
+	value := strings.NewReplacer("\r\n", "").Replace(field[colon+1:])
+	return name + ":" + strings.TrimSpace(compressWhitespace(value))
+}
+
+// canonicalBody relaxed规范化正文：行内连续空白压缩为一个空格，去掉行尾空白和末尾空行
+func canonicalBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(compressWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// compressWhitespace 将连续的空格和制表符压缩为一个空格
+func compressWhitespace(value string) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range value {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			builder.WriteByte(' ')
+			space = false
+		}
+		builder.WriteRune(r)
+	}
+	if space {
+		builder.WriteByte(' ')
+	}
+	return builder.String()
+}
+
+// foldBase64 将签名值按72个字符折行
+func foldBase64(value string) string {
+	var builder strings.Builder
+	for len(value) > 72 {
+		builder.WriteString(value[:72])
+		builder.WriteString("\r\n\t")
+		value = value[72:]
+	}
+	builder.WriteString(value)
+	return builder.String()
+}
@@ -0,0 +1,290 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"PushServer/internal/config"
+)
+
+// RFC 8463 附录A的Ed25519测试密钥和示例邮件
+const (
+	rfc8463Seed      = "nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="
+	rfc8463PublicKey = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	rfc8463BodyHash  = "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8="
+	rfc8463Time      = 1528637909
+
+	rfc8463Header = "From: Joe SixPack <joe@football.example.com>\r\n" +
+		"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+		"Subject: Is dinner ready?\r\n" +
+		"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+		"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n"
+	rfc8463Body    = "Hi.\r\n\r\nWe lost the game.  Are you hungry yet?\r\n\r\nJoe.\r\n"
+	rfc8463Message = rfc8463Header + "\r\n" + rfc8463Body
+
+	rfc8463Signature = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+		" d=football.example.com; i=@football.example.com;\r\n" +
+		" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+		" subject : date : message-id : from : subject : date;\r\n" +
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11BusFa3bT3FY5OsU\r\n" +
+		" 7ZbnKELq+eXdp1Q1Dw=="
+
+	// 使用RFC 8463密钥、固定时间戳和DefaultHeaders签名示例邮件的结果，Ed25519签名是确定的
+	knownEd25519Signature = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed; d=football.example.com; s=brisbane;\r\n" +
+		"\tt=1528637909; h=from:subject:date:to:message-id;\r\n" +
+		"\tbh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		"\tb=eSla0C2/M8+lG2gn/w//6dj+11hY345AVJ0IokKWaEfyNDsPuAaUIogcHdLfRsbrcH2p1kaQ\r\n" +
+		"\tax8/ojBsWQjQAg==\r\n"
+)
+
+func TestCanonicalHeaderRFC6376(t *testing.T) {
+	// RFC 6376 3.4.5 示例
+	cases := map[string]string{
+		"A: X":                "a:X",
+		"B : Y\t\r\n\tZ  ":    "b:Y Z",
+		"Subject:  Is   it?":  "subject:Is it?",
+		"X-Empty:":            "x-empty:",
+		"TO:\tSuzie Q <s@x> ": "to:Suzie Q <s@x>",
+	}
+	for input, want := range cases {
+		if got := canonicalHeader(input); got != want {
+			t.Errorf("canonicalHeader(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCanonicalBodyRFC6376(t *testing.T) {
+	cases := []struct {
+		body string
+		want string
+	}{
+		// RFC 6376 3.4.5 示例
+		{" C \r\nD \t E\r\n\r\n\r\n", " C\r\nD E\r\n"},
+		// 空正文和只有空行的正文规范化为空
+		{"", ""},
+		{"\r\n\r\n", ""},
+		// 缺少结尾换行时补上CRLF
+		{"text", "text\r\n"},
+	}
+	for _, tc := range cases {
+		if got := string(canonicalBody([]byte(tc.body))); got != tc.want {
+			t.Errorf("canonicalBody(%q) = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestBodyHashRFC8463(t *testing.T) {
+	hash := sha256.Sum256(canonicalBody([]byte(rfc8463Body)))
+	if got := base64.StdEncoding.EncodeToString(hash[:]); got != rfc8463BodyHash {
+		t.Errorf("body hash = %s, want %s", got, rfc8463BodyHash)
+	}
+}
+
+func TestVerifyRFC8463Signature(t *testing.T) {
+	// 用本包的规范化实现重建RFC示例的签名输入，验证其中给出的签名
+	publicKey, _ := base64.StdEncoding.DecodeString(rfc8463PublicKey)
+	if !verifySignature(ed25519.PublicKey(publicKey), rfc8463Signature, rfc8463Header) {
+		t.Fatal("RFC 8463 example signature did not verify")
+	}
+}
+
+func TestSignEd25519KnownAnswer(t *testing.T) {
+	signer := newTestSigner(t, "football.example.com", "brisbane", rfc8463Key(t))
+	fixTime(t, rfc8463Time)
+
+	signed, err := signer.Sign([]byte(rfc8463Message))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	field, rest := cutSignature(t, string(signed))
+	if rest != rfc8463Message {
+		t.Errorf("signed message body changed:\n%q", rest)
+	}
+
+	if field+"\r\n" != knownEd25519Signature {
+		t.Errorf("DKIM-Signature =\n%q\nwant\n%q", field+"\r\n", knownEd25519Signature)
+	}
+
+	publicKey, _ := base64.StdEncoding.DecodeString(rfc8463PublicKey)
+	if !verifySignature(ed25519.PublicKey(publicKey), field, rfc8463Header) {
+		t.Error("signature did not verify with the RFC 8463 public key")
+	}
+}
+
+func TestSignRSAVerifies(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := newTestSigner(t, "football.example.com", "rsa", key)
+
+	signed, err := signer.Sign([]byte(rfc8463Message))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	field, _ := cutSignature(t, string(signed))
+	if !strings.Contains(field, "a=rsa-sha256;") || !strings.Contains(field, "bh="+rfc8463BodyHash+";") {
+		t.Errorf("unexpected DKIM-Signature: %q", field)
+	}
+	if !verifySignature(&key.PublicKey, field, rfc8463Header) {
+		t.Error("RSA signature did not verify")
+	}
+}
+
+func TestSignSelectsSignerByFromDomain(t *testing.T) {
+	previous := signers
+	t.Cleanup(func() { signers = previous })
+	signers = []*Signer{
+		newTestSigner(t, "example.com", "top", rfc8463Key(t)),
+		newTestSigner(t, "football.example.com", "brisbane", rfc8463Key(t)),
+	}
+
+	cases := map[string]string{
+		"Joe <joe@football.example.com>":         "d=football.example.com; s=brisbane;",
+		"Joe <joe@tickets.football.example.com>": "d=football.example.com; s=brisbane;",
+		"ops@Example.COM":                        "d=example.com; s=top;",
+		"someone@other.org":                      "",
+	}
+	for from, want := range cases {
+		message := strings.Replace(rfc8463Message, "Joe SixPack <joe@football.example.com>", from, 1)
+		signed, err := Sign([]byte(message))
+		if err != nil {
+			t.Fatalf("Sign(%s): %v", from, err)
+		}
+		if want == "" {
+			if string(signed) != message {
+				t.Errorf("From %s: message signed without a matching domain", from)
+			}
+			continue
+		}
+		if !strings.HasPrefix(string(signed), "DKIM-Signature:") || !strings.Contains(string(signed), want) {
+			t.Errorf("From %s: want signature with %q, got %q", from, want, strings.SplitN(string(signed), "\r\n", 2)[0])
+		}
+		if !CanSign(strings.Trim(from[strings.LastIndex(from, " ")+1:], "<>")) {
+			t.Errorf("CanSign(%s) = false", from)
+		}
+	}
+	if CanSign("someone@other.org") {
+		t.Error("CanSign(other.org) = true")
+	}
+}
+
+func TestSignNormalizesBareLF(t *testing.T) {
+	previous := signers
+	t.Cleanup(func() { signers = previous })
+	signers = []*Signer{newTestSigner(t, "football.example.com", "brisbane", rfc8463Key(t))}
+	fixTime(t, rfc8463Time)
+
+	signed, err := Sign([]byte(strings.ReplaceAll(rfc8463Message, "\r\n", "\n")))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	field, rest := cutSignature(t, string(signed))
+	if rest != rfc8463Message {
+		t.Errorf("message not normalized to CRLF: %q", rest)
+	}
+	publicKey, _ := base64.StdEncoding.DecodeString(rfc8463PublicKey)
+	if !verifySignature(ed25519.PublicKey(publicKey), field, rfc8463Header) {
+		t.Error("signature over LF-only message did not verify")
+	}
+}
+
+func rfc8463Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	seed, err := base64.StdEncoding.DecodeString(rfc8463Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// newTestSigner 通过PKCS#8 PEM配置创建签名器，与从配置文件加载私钥的路径一致
+func newTestSigner(t *testing.T, domain, selector string, key interface{}) *Signer {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(config.DKIMDomainConfig{
+		Domain:     domain,
+		Selector:   selector,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return signer
+}
+
+func fixTime(t *testing.T, unix int64) {
+	t.Helper()
+	previous := now
+	t.Cleanup(func() { now = previous })
+	now = func() time.Time { return time.Unix(unix, 0) }
+}
+
+// cutSignature 拆出签名后邮件开头的DKIM-Signature头(不含结尾CRLF)和原邮件
+func cutSignature(t *testing.T, signed string) (string, string) {
+	t.Helper()
+	fields := splitHeaderFields([]byte(signed[:strings.Index(signed, "\r\n\r\n")+2]))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "DKIM-Signature:") {
+		t.Fatalf("signed message does not start with DKIM-Signature: %q", signed)
+	}
+	return fields[0], signed[len(fields[0])+2:]
+}
+
+// verifySignature 按RFC 6376 3.7独立验证签名：按h=依次取邮件头，最后加上b=置空的签名头
+func verifySignature(publicKey interface{}, field, header string) bool {
+	_, value, _ := strings.Cut(field, ":")
+	tags := strings.Split(value, ";")
+	var names []string
+	var signature string
+	for i, tag := range tags {
+		name, tagValue, _ := strings.Cut(tag, "=")
+		tagValue = strings.NewReplacer("\r\n", "", " ", "", "\t", "").Replace(tagValue)
+		switch strings.TrimSpace(name) {
+		case "h":
+			names = strings.Split(tagValue, ":")
+		case "b":
+			signature = tagValue
+			tags[i] = name + "="
+		}
+	}
+
+	fields := splitHeaderFields([]byte(header))
+	used := make([]bool, len(fields))
+	var data strings.Builder
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(fields[i]), name) {
+				used[i] = true
+				data.WriteString(canonicalHeader(fields[i]) + "\r\n")
+				break
+			}
+		}
+	}
+	data.WriteString(canonicalHeader("DKIM-Signature:" + strings.Join(tags, ";")))
+	digest := sha256.Sum256([]byte(data.String()))
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"PushServer/internal/audit"
+	"PushServer/internal/auth"
+)
+
+// recordAudit 记录当前请求的审计事件，调用方取自认证主体
+func recordAudit(c *gin.Context, action, target, result string, details map[string]interface{}) {
+	actor := "anonymous"
+	if principal := auth.FromContext(c); principal != nil {
+		actor = principal.String()
+	}
+	audit.Record(actor, action, target, c.ClientIP(), result, details)
+}
+
+// auditResult 将操作是否成功转换为审计结果
+func auditResult(success bool) string {
+	if success {
+		return audit.ResultSuccess
+	}
+	return audit.ResultFailure
+}
+
+// GetAuditEvents 查询审计日志
+func GetAuditEvents(c *gin.Context) {
+	if audit.Manager == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "审计日志未启用",
+			"data":    nil,
+		})
+		return
+	}
+
+	filter := audit.Filter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+	}
+	for name, field := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": "无效的时间参数" + name + "，应为RFC3339格式",
+					"data":    nil,
+				})
+				return
+			}
+			*field = t
+		}
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil {
+			filter.Limit = limit
+		}
+	}
+
+	events, verify, err := audit.Manager.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "读取审计日志失败: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "获取审计日志成功",
+		"data": gin.H{
+			"events": events,
+			"count":  len(events),
+			"chain":  verify,
+		},
+	})
+}
+
+// VerifyAuditLog 校验审计日志哈希链
+func VerifyAuditLog(c *gin.Context) {
+	if audit.Manager == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "审计日志未启用",
+			"data":    nil,
+		})
+		return
+	}
+
+	result, err := audit.Manager.Verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "读取审计日志失败: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "审计日志校验完成",
+		"data":    result,
+	})
+}
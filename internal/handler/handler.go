@@ -1,16 +1,31 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"PushServer/internal/audit"
+	"PushServer/internal/auth"
 	"PushServer/internal/config"
+	"PushServer/internal/health"
 	"PushServer/internal/logger"
 	"PushServer/internal/model"
 	"PushServer/internal/queue"
+	"PushServer/internal/ratelimit"
 	"PushServer/internal/task"
+	"PushServer/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// statusClientClosedRequest 调用方在处理完成前断开连接(沿用nginx的499状态码)
+const statusClientClosedRequest = 499
+
 // Response 统一响应结构
 type Response struct {
 	Code    int         `json:"code"`
@@ -29,8 +44,54 @@ func HealthCheck(c *gin.Context) {
 	})
 }
 
+// Ready 就绪检查，只执行关键检查项，未就绪时返回503
+func Ready(c *gin.Context) {
+	report := health.Run(c.Request.Context(), true)
+
+	if !report.Ready {
+		c.JSON(http.StatusServiceUnavailable, Response{
+			Code:    503,
+			Message: "服务未就绪",
+			Data:    report,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "服务已就绪",
+		Data:    report,
+	})
+}
+
+// HealthDetails 详细健康检查，执行全部检查项
+func HealthDetails(c *gin.Context) {
+	report := health.Run(c.Request.Context(), false)
+
+	status := http.StatusOK
+	message := "服务运行正常"
+	switch {
+	case !report.Ready:
+		status = http.StatusServiceUnavailable
+		message = "服务未就绪"
+	case report.Status != health.StatusPass:
+		message = "服务降级运行"
+	}
+
+	c.JSON(status, Response{
+		Code:    status,
+		Message: message,
+		Data:    report,
+	})
+}
+
 // PushMessage 推送消息
 func PushMessage(c *gin.Context) {
+	// 接受上游传入的traceparent，创建处理请求的span
+	ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+	ctx, span := tracing.Tracer().Start(ctx, "handler.PushMessage", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
 	var req model.PushRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Errorf("参数绑定失败: %v", err)
@@ -54,6 +115,38 @@ func PushMessage(c *gin.Context) {
 		return
 	}
 
+	// 检查调用方的接收者和平台范围
+	principal := auth.FromContext(c)
+	if principal != nil {
+		if !principal.AllowsRecipient(req.RecipientAlias) {
+			logger.Warnf("调用方 %s 无权推送到接收者: %s", principal, req.RecipientAlias)
+			recordAudit(c, audit.ActionPushSubmit, req.RecipientAlias, audit.ResultDenied, map[string]interface{}{"reason": "接收者不在授权范围内"})
+			c.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "无权推送到接收者: " + req.RecipientAlias,
+			})
+			return
+		}
+		if req.Platform == "" && !principal.AllPlatforms() {
+			logger.Warnf("调用方 %s 仅允许推送到指定平台，请求未指定platform: 接收者=%s", principal, req.RecipientAlias)
+			recordAudit(c, audit.ActionPushSubmit, req.RecipientAlias, audit.ResultDenied, map[string]interface{}{"reason": "未指定平台，密钥仅允许推送到指定平台"})
+			c.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "当前密钥仅允许推送到指定平台，请在请求中指定platform",
+			})
+			return
+		}
+		if req.Platform != "" && !principal.AllowsPlatform(req.Platform) {
+			logger.Warnf("调用方 %s 无权使用平台: %s", principal, req.Platform)
+			recordAudit(c, audit.ActionPushSubmit, req.RecipientAlias, audit.ResultDenied, map[string]interface{}{"reason": "平台不在授权范围内", "platform": req.Platform})
+			c.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "无权使用平台: " + req.Platform,
+			})
+			return
+		}
+	}
+
 	// 检查接收者是否存在
 	recipient, exists := config.AppConfig.GetRecipient(req.RecipientAlias)
 	if !exists {
@@ -65,33 +158,79 @@ func PushMessage(c *gin.Context) {
 		return
 	}
 
+	// 按接收者限流，避免单个接收者的告警风暴占满队列；先校验接收者，避免未知别名创建令牌桶
+	if allowed, wait := ratelimit.Allow(ratelimit.DimensionRecipient, req.RecipientAlias); !allowed {
+		ratelimit.Abort(c, ratelimit.DimensionRecipient, req.RecipientAlias, wait)
+		return
+	}
+
 	logger.Infof("收到推送请求: 接收者=%s, 类型=%s, 策略=%s, 标题=%s",
 		req.RecipientAlias, req.Type, req.Strategy, req.Content.Title)
 
 	// 创建任务
 	newTask := task.Manager.CreateTask(req)
+	traceID := tracing.TraceID(ctx)
+	if traceID != "" {
+		task.Manager.SetTraceID(newTask.ID, traceID)
+	}
+	if principal != nil {
+		task.Manager.SetCaller(newTask.ID, principal.String())
+	}
+	span.SetAttributes(
+		attribute.String("push.task_id", newTask.ID),
+		attribute.String("push.recipient", req.RecipientAlias),
+	)
 
 	// 添加到队列
 	job := queue.PushJob{
-		TaskID:  newTask.ID,
-		Request: req,
+		TaskID:       newTask.ID,
+		Request:      req,
+		EnqueuedAt:   time.Now(),
+		TraceContext: ctx,
 	}
 
-	if err := queue.PushQueue.AddJob(job); err != nil {
+	if err := queue.PushQueue.AddJobWithWait(c.Request.Context(), job, enqueueWait(c)); err != nil {
+		// 调用方断开连接或超时导致等待中止，不属于队列饱和，不返回Retry-After
+		if c.Request.Context().Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			logger.Warnf("调用方在等待入队时取消请求: 任务ID=%s, 原因: %v", newTask.ID, err)
+			task.Manager.SetTaskError(newTask.ID, "调用方已取消请求")
+			recordAudit(c, audit.ActionPushSubmit, req.RecipientAlias, audit.ResultAborted, pushAuditDetails(newTask.ID, req, "调用方已取消请求"))
+			span.SetStatus(codes.Error, err.Error())
+			c.JSON(statusClientClosedRequest, Response{
+				Code:    statusClientClosedRequest,
+				Message: "请求已取消",
+				Data:    gin.H{"task_id": newTask.ID},
+			})
+			return
+		}
+
 		logger.Errorf("添加任务到队列失败: %v", err)
 		task.Manager.SetTaskError(newTask.ID, "队列已满，请稍后重试")
+		recordAudit(c, audit.ActionPushSubmit, req.RecipientAlias, audit.ResultFailure, pushAuditDetails(newTask.ID, req, "队列已满"))
+		span.SetStatus(codes.Error, err.Error())
+
+		retryAfter := int(queue.PushQueue.RetryAfter().Seconds())
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
 		c.JSON(http.StatusServiceUnavailable, Response{
 			Code:    503,
 			Message: "服务繁忙，请稍后重试",
+			Data: gin.H{
+				"task_id":     newTask.ID,
+				"retry_after": retryAfter,
+				"queue":       queue.PushQueue.Stats(),
+			},
 		})
 		return
 	}
 
+	recordAudit(c, audit.ActionPushSubmit, req.RecipientAlias, audit.ResultSuccess, pushAuditDetails(newTask.ID, req, ""))
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "消息推送任务已创建",
 		Data: gin.H{
 			"task_id":   newTask.ID,
+			"trace_id":  traceID,
 			"recipient": recipient.Name,
 			"type":      req.Type,
 			"strategy":  req.Strategy,
@@ -101,6 +240,55 @@ func PushMessage(c *gin.Context) {
 	})
 }
 
+// pushAuditDetails 推送审计事件的详情，只记录标题不记录正文
+func pushAuditDetails(taskID string, req model.PushRequest, reason string) map[string]interface{} {
+	details := map[string]interface{}{
+		"task_id":  taskID,
+		"type":     req.Type,
+		"strategy": req.Strategy,
+		"title":    req.Content.Title,
+	}
+	if req.Platform != "" {
+		details["platform"] = req.Platform
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	return details
+}
+
+// enqueueWait 计算本次请求的入队等待时间
+// 调用方可通过wait查询参数(毫秒)指定，上限为max_enqueue_wait；
+// 未配置max_enqueue_wait时调用方最多只能请求enqueue_wait
+func enqueueWait(c *gin.Context) time.Duration {
+	waitMs := config.AppConfig.Queue.EnqueueWait
+	if waitStr := c.Query("wait"); waitStr != "" {
+		if w, err := strconv.Atoi(waitStr); err == nil && w >= 0 {
+			maxWait := config.AppConfig.Queue.MaxEnqueueWait
+			if maxWait <= 0 {
+				maxWait = config.AppConfig.Queue.EnqueueWait
+			}
+			waitMs = min(w, maxWait)
+		}
+	}
+
+	return time.Duration(waitMs) * time.Millisecond
+}
+
+// GetQueueStatistics 获取队列运行指标
+func GetQueueStatistics(c *gin.Context) {
+	stats := queue.PushQueue.Stats()
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "获取队列指标成功",
+		Data: gin.H{
+			"statistics":  stats,
+			"retry_after": int(queue.PushQueue.RetryAfter().Seconds()),
+		},
+	})
+}
+
 // GetTaskStatus 获取任务状态
 func GetTaskStatus(c *gin.Context) {
 	taskID := c.Param("id")
@@ -121,6 +309,18 @@ func GetTaskStatus(c *gin.Context) {
 		return
 	}
 
+	// 只能查看授权接收者范围内的任务
+	if principal := auth.FromContext(c); principal != nil {
+		if req, ok := taskInfo.Request.(model.PushRequest); ok && !principal.AllowsRecipient(req.RecipientAlias) {
+			logger.Warnf("调用方 %s 无权查看接收者 %s 的任务: %s", principal, req.RecipientAlias, taskID)
+			c.JSON(http.StatusForbidden, Response{
+				Code:    403,
+				Message: "无权查看该任务",
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "获取任务状态成功",
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"PushServer/internal/metrics"
+	"PushServer/internal/notification"
+	"PushServer/internal/queue"
+	"PushServer/internal/task"
+)
+
+var registerStateCollector sync.Once
+
+// stateCollector 在采集时读取队列、任务和通知中心的当前状态
+type stateCollector struct {
+	queueDepth          *prometheus.Desc
+	queueCapacity       *prometheus.Desc
+	queueBusyWorkers    *prometheus.Desc
+	queueProcessed      *prometheus.Desc
+	queueRejected       *prometheus.Desc
+	tasks               *prometheus.Desc
+	notificationsUnread *prometheus.Desc
+}
+
+func newStateCollector() *stateCollector {
+	return &stateCollector{
+		queueDepth:          metrics.NewDesc("queue_depth", "当前排队任务数"),
+		queueCapacity:       metrics.NewDesc("queue_capacity", "队列容量"),
+		queueBusyWorkers:    metrics.NewDesc("queue_busy_workers", "正在处理任务的工作协程数"),
+		queueProcessed:      metrics.NewDesc("queue_processed_total", "已处理的任务数"),
+		queueRejected:       metrics.NewDesc("queue_rejected_total", "因队列已满被拒绝的任务数"),
+		tasks:               metrics.NewDesc("tasks", "当前保存的任务数", "status"),
+		notificationsUnread: metrics.NewDesc("notifications_unread", "通知中心未读通知数"),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (sc *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.queueDepth
+	ch <- sc.queueCapacity
+	ch <- sc.queueBusyWorkers
+	ch <- sc.queueProcessed
+	ch <- sc.queueRejected
+	ch <- sc.tasks
+	ch <- sc.notificationsUnread
+}
+
+// Collect 实现prometheus.Collector接口
+func (sc *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	if queue.PushQueue != nil {
+		stats := queue.PushQueue.Stats()
+		ch <- prometheus.MustNewConstMetric(sc.queueDepth, prometheus.GaugeValue, float64(stats.Depth))
+		ch <- prometheus.MustNewConstMetric(sc.queueCapacity, prometheus.GaugeValue, float64(stats.Capacity))
+		ch <- prometheus.MustNewConstMetric(sc.queueBusyWorkers, prometheus.GaugeValue, float64(stats.BusyWorkers))
+		ch <- prometheus.MustNewConstMetric(sc.queueProcessed, prometheus.CounterValue, float64(stats.Processed))
+		ch <- prometheus.MustNewConstMetric(sc.queueRejected, prometheus.CounterValue, float64(stats.Rejected))
+	}
+
+	if task.Manager != nil {
+		for status, count := range task.Manager.CountByStatus() {
+			ch <- prometheus.MustNewConstMetric(sc.tasks, prometheus.GaugeValue, float64(count), string(status))
+		}
+	}
+
+	if notification.Manager != nil {
+		ch <- prometheus.MustNewConstMetric(sc.notificationsUnread, prometheus.GaugeValue, float64(notification.Manager.GetUnreadCount()))
+	}
+}
+
+// Metrics 导出Prometheus指标
+func Metrics() gin.HandlerFunc {
+	registerStateCollector.Do(func() {
+		metrics.Registry.MustRegister(newStateCollector())
+	})
+
+	h := metrics.Handler()
+	return func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
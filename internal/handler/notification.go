@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"PushServer/internal/audit"
 	"PushServer/internal/notification"
 )
 
@@ -120,6 +121,7 @@ func MarkNotificationAsRead(c *gin.Context) {
 	}
 
 	success := notification.Manager.MarkAsRead(notificationID)
+	recordAudit(c, audit.ActionNotificationRead, notificationID, auditResult(success), nil)
 	if !success {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
@@ -143,6 +145,7 @@ func MarkNotificationAsRead(c *gin.Context) {
 // MarkAllNotificationsAsRead 标记所有通知为已读
 func MarkAllNotificationsAsRead(c *gin.Context) {
 	count := notification.Manager.MarkAllAsRead()
+	recordAudit(c, audit.ActionNotificationRead, "*", audit.ResultSuccess, map[string]interface{}{"count": count})
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -167,6 +170,7 @@ func DeleteSystemNotification(c *gin.Context) {
 	}
 
 	success := notification.Manager.DeleteNotification(notificationID)
+	recordAudit(c, audit.ActionNotificationDelete, notificationID, auditResult(success), nil)
 	if !success {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
@@ -190,6 +194,7 @@ func DeleteSystemNotification(c *gin.Context) {
 // ClearAllNotifications 清空所有系统通知
 func ClearAllNotifications(c *gin.Context) {
 	count := notification.Manager.ClearAllNotifications()
+	recordAudit(c, audit.ActionNotificationClear, "*", audit.ResultSuccess, map[string]interface{}{"count": count})
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
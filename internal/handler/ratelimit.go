@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"PushServer/internal/ratelimit"
+)
+
+// GetRateLimitUsage 获取推送接口限流的当前使用情况
+func GetRateLimitUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "获取限流使用情况成功",
+		"data": gin.H{
+			"enabled": ratelimit.Enabled(),
+			"usage":   ratelimit.UsageReport(),
+		},
+	})
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
+	"PushServer/internal/audit"
 	smtpRelay "PushServer/internal/smtp"
 )
 
@@ -35,3 +37,94 @@ func GetSMTPRelayStatus(c *gin.Context) {
 		},
 	})
 }
+
+// spoolUnavailable SMTP中继队列未启用时的响应
+func spoolUnavailable(c *gin.Context) bool {
+	if smtpRelay.Spool != nil {
+		return false
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"code":    404,
+		"message": "SMTP中继队列未启用",
+		"data":    nil,
+	})
+	return true
+}
+
+// GetSMTPRelayQueue 获取SMTP中继队列中等待投递的邮件
+func GetSMTPRelayQueue(c *gin.Context) {
+	if spoolUnavailable(c) {
+		return
+	}
+
+	entries := smtpRelay.Spool.List()
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "获取SMTP中继队列成功",
+		"data": gin.H{
+			"messages": entries,
+			"total":    len(entries),
+		},
+	})
+}
+
+// RetrySMTPRelayQueueMessage 立即重试队列中的邮件
+func RetrySMTPRelayQueueMessage(c *gin.Context) {
+	if spoolUnavailable(c) {
+		return
+	}
+
+	id := c.Param("id")
+	err := smtpRelay.Spool.Retry(id)
+	recordAudit(c, audit.ActionSMTPQueueRetry, id, auditResult(err == nil), nil)
+	if err != nil {
+		spoolError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已安排立即重试",
+		"data": gin.H{
+			"id": id,
+		},
+	})
+}
+
+// DeleteSMTPRelayQueueMessage 从队列中删除邮件
+func DeleteSMTPRelayQueueMessage(c *gin.Context) {
+	if spoolUnavailable(c) {
+		return
+	}
+
+	id := c.Param("id")
+	err := smtpRelay.Spool.Delete(id)
+	recordAudit(c, audit.ActionSMTPQueueDelete, id, auditResult(err == nil), nil)
+	if err != nil {
+		spoolError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "删除队列邮件成功",
+		"data": gin.H{
+			"id": id,
+		},
+	})
+}
+
+// spoolError 队列操作失败的响应
+func spoolError(c *gin.Context, id string, err error) {
+	status := http.StatusNotFound
+	if errors.Is(err, smtpRelay.ErrSpoolEntryDelivering) {
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"code":    status,
+		"message": err.Error(),
+		"data": gin.H{
+			"id": id,
+		},
+	})
+}
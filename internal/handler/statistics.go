@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"PushServer/internal/statistics"
+)
+
+// GetDeliveryStatistics 获取投递统计
+func GetDeliveryStatistics(c *gin.Context) {
+	window := time.Hour // 默认统计最近1小时
+	if windowStr := c.Query("window"); windowStr != "" {
+		w, err := time.ParseDuration(windowStr)
+		if err != nil || w <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的统计窗口: " + windowStr,
+				"data":    nil,
+			})
+			return
+		}
+		window = w
+	}
+
+	if retention := statistics.Manager.Retention(); window > retention {
+		window = retention
+	}
+
+	report := statistics.Manager.Report(window)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "获取投递统计成功",
+		"data": gin.H{
+			"statistics": report,
+		},
+	})
+}
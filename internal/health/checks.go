@@ -0,0 +1,278 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"PushServer/internal/config"
+	"PushServer/internal/queue"
+	"PushServer/internal/smtp"
+	"PushServer/internal/task"
+)
+
+// defaultSaturationThreshold 默认队列饱和度告警阈值
+const defaultSaturationThreshold = 0.8
+
+// RegisterDefaultChecks 注册内置检查项
+func RegisterDefaultChecks() {
+	cfg := config.AppConfig.Health
+	SetTimeout(time.Duration(cfg.Timeout) * time.Millisecond)
+
+	Register("queue", true, checkQueue)
+	Register("workers", true, checkWorkers)
+	Register("task_store", true, checkTaskStore)
+	Register("log_file", false, checkLogFile)
+
+	if cfg.CheckWebhooks {
+		Register("webhook_hosts", false, checkWebhookHosts)
+	}
+}
+
+// RegisterSMTPChecks 注册SMTP中继相关检查项
+func RegisterSMTPChecks(server *smtp.SMTPServer) {
+	Register("smtp_relay_listener", server.IsEnabled(), func(ctx context.Context) Result {
+		return checkSMTPListener(server)
+	})
+	Register("smtp_relay_accounts", false, func(ctx context.Context) Result {
+		return checkSMTPAccounts(server)
+	})
+}
+
+// checkQueue 检查队列饱和度
+func checkQueue(ctx context.Context) Result {
+	if queue.PushQueue == nil {
+		return Result{Status: StatusFail, Message: "队列未初始化"}
+	}
+
+	stats := queue.PushQueue.Stats()
+	threshold := config.AppConfig.Health.QueueSaturationThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = defaultSaturationThreshold
+	}
+
+	details := map[string]interface{}{
+		"depth":      stats.Depth,
+		"capacity":   stats.Capacity,
+		"saturation": stats.Saturation,
+		"threshold":  threshold,
+		"drain_rate": stats.DrainRate,
+	}
+
+	switch {
+	case stats.Capacity > 0 && stats.Depth >= stats.Capacity:
+		return Result{Status: StatusFail, Message: "队列已满", Details: details}
+	case stats.Saturation >= threshold:
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("队列饱和度 %.0f%% 超过阈值", stats.Saturation*100), Details: details}
+	default:
+		return Result{Status: StatusPass, Details: details}
+	}
+}
+
+// checkWorkers 检查工作协程存活情况
+func checkWorkers(ctx context.Context) Result {
+	if queue.PushQueue == nil {
+		return Result{Status: StatusFail, Message: "队列未初始化"}
+	}
+
+	stats := queue.PushQueue.Stats()
+	details := map[string]interface{}{
+		"workers":       stats.Workers,
+		"alive_workers": stats.AliveWorkers,
+		"busy_workers":  stats.BusyWorkers,
+		"utilization":   stats.Utilization,
+	}
+
+	switch {
+	case stats.AliveWorkers == 0:
+		return Result{Status: StatusFail, Message: "没有存活的工作协程", Details: details}
+	case stats.AliveWorkers < stats.Workers:
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("%d 个工作协程已退出", stats.Workers-stats.AliveWorkers), Details: details}
+	default:
+		return Result{Status: StatusPass, Details: details}
+	}
+}
+
+// checkTaskStore 检查任务存储
+func checkTaskStore(ctx context.Context) Result {
+	if task.Manager == nil {
+		return Result{Status: StatusFail, Message: "任务管理器未初始化"}
+	}
+
+	counts := task.Manager.CountByStatus()
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	return Result{Status: StatusPass, Details: map[string]interface{}{"tasks": total}}
+}
+
+// checkLogFile 检查日志文件是否可写
+func checkLogFile(ctx context.Context) Result {
+	logCfg := config.AppConfig.Log
+	if strings.ToLower(logCfg.Output) != "file" {
+		return Result{Status: StatusPass, Message: "日志输出到标准输出"}
+	}
+
+	var failed []string
+	for _, path := range []string{logCfg.FilePath, logCfg.ErrorFilePath, logCfg.InfoFilePath, logCfg.DebugFilePath} {
+		if path == "" {
+			continue
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		file.Close()
+	}
+
+	if len(failed) > 0 {
+		return Result{Status: StatusFail, Message: "日志文件不可写", Details: failed}
+	}
+	return Result{Status: StatusPass}
+}
+
+// checkSMTPListener 检查SMTP中继是否在监听
+func checkSMTPListener(server *smtp.SMTPServer) Result {
+	if !server.IsEnabled() {
+		return Result{Status: StatusPass, Message: "SMTP中继未启用"}
+	}
+	if !server.IsRunning() {
+		return Result{Status: StatusFail, Message: "SMTP中继服务器未在监听"}
+	}
+	// /ready不需要认证，不返回监听地址
+	return Result{Status: StatusPass}
+}
+
+// checkSMTPAccounts 检查SMTP中继账户，全部处于冷却或已达每日上限时判定失败
+func checkSMTPAccounts(server *smtp.SMTPServer) Result {
+	if !server.IsEnabled() {
+		return Result{Status: StatusPass, Message: "SMTP中继未启用"}
+	}
+
+	enabled, usable := smtp.NewRelayService().AccountAvailability()
+	details := map[string]interface{}{
+		"enabled": enabled,
+		"usable":  usable,
+	}
+	switch {
+	case len(enabled) == 0:
+		return Result{Status: StatusFail, Message: "没有配置可用的SMTP账户", Details: details}
+	case len(usable) == 0:
+		return Result{Status: StatusFail, Message: "所有SMTP账户均处于冷却或已达每日上限", Details: details}
+	case len(usable) < len(enabled):
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("%d 个SMTP账户处于冷却或已达每日上限", len(enabled)-len(usable)), Details: details}
+	default:
+		return Result{Status: StatusPass, Details: details}
+	}
+}
+
+// webhookCacheTTL webhook可达性结果的缓存时间，避免每次请求都向所有主机建立连接
+const webhookCacheTTL = time.Minute
+
+// webhookCache 最近一次webhook可达性检查的结果，检查期间持有锁，并发请求等待同一次检查
+var webhookCache struct {
+	mutex     sync.Mutex
+	result    Result
+	checkedAt time.Time
+}
+
+// checkWebhookHosts 检查已启用webhook主机的TCP可达性，结果缓存webhookCacheTTL
+func checkWebhookHosts(ctx context.Context) Result {
+	webhookCache.mutex.Lock()
+	defer webhookCache.mutex.Unlock()
+	if !webhookCache.checkedAt.IsZero() && time.Since(webhookCache.checkedAt) < webhookCacheTTL {
+		return webhookCache.result
+	}
+
+	result := probeWebhookHosts(ctx)
+	// 请求被取消时的结果不可信，不缓存
+	if ctx.Err() == nil {
+		webhookCache.result = result
+		webhookCache.checkedAt = time.Now()
+	}
+	return result
+}
+
+// probeWebhookHosts 并发连接各webhook主机
+func probeWebhookHosts(ctx context.Context) Result {
+	hosts := webhookHosts()
+	if len(hosts) == 0 {
+		return Result{Status: StatusPass, Message: "没有需要检查的webhook主机"}
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	unreachable := make(map[string]string)
+	dialer := &net.Dialer{}
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			conn, err := dialer.DialContext(ctx, "tcp", host)
+			if err != nil {
+				mutex.Lock()
+				unreachable[host] = err.Error()
+				mutex.Unlock()
+				return
+			}
+			conn.Close()
+		}(host)
+	}
+	wg.Wait()
+
+	details := map[string]interface{}{
+		"hosts":       hosts,
+		"unreachable": unreachable,
+	}
+	switch {
+	case len(unreachable) == len(hosts):
+		return Result{Status: StatusFail, Message: "所有webhook主机均不可达", Details: details}
+	case len(unreachable) > 0:
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("%d 个webhook主机不可达", len(unreachable)), Details: details}
+	default:
+		return Result{Status: StatusPass, Details: details}
+	}
+}
+
+// webhookHosts 收集所有已启用平台中webhook的主机地址
+func webhookHosts() []string {
+	seen := make(map[string]bool)
+	for _, recipient := range config.AppConfig.Recipients {
+		for _, platformConfig := range recipient.Platforms {
+			if !platformConfig.Enabled {
+				continue
+			}
+			for _, webhook := range platformConfig.Webhooks {
+				u, err := url.Parse(webhook.URL)
+				if err != nil || u.Hostname() == "" {
+					continue
+				}
+				port := u.Port()
+				if port == "" {
+					port = "443"
+					if u.Scheme == "http" {
+						port = "80"
+					}
+				}
+				seen[net.JoinHostPort(u.Hostname(), port)] = true
+			}
+		}
+	}
+
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status 检查状态
+type Status string
+
+const (
+	StatusPass Status = "pass" // 正常
+	StatusWarn Status = "warn" // 降级
+	StatusFail Status = "fail" // 异常
+)
+
+// Result 单项检查结果
+type Result struct {
+	Status  Status
+	Message string
+	Details interface{}
+}
+
+// CheckFunc 检查函数
+type CheckFunc func(ctx context.Context) Result
+
+// Check 已注册的检查项
+type Check struct {
+	Name     string
+	Critical bool // 关键检查失败时服务视为未就绪
+	Fn       CheckFunc
+}
+
+// CheckReport 单项检查报告
+type CheckReport struct {
+	Name      string      `json:"name"`
+	Status    Status      `json:"status"`
+	Critical  bool        `json:"critical"`
+	LatencyMs float64     `json:"latency_ms"`
+	Message   string      `json:"message,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Report 检查报告
+type Report struct {
+	Status    Status        `json:"status"`
+	Ready     bool          `json:"ready"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []CheckReport `json:"checks"`
+}
+
+var (
+	checks      []Check
+	checksMutex sync.RWMutex
+
+	// checkTimeout 单项检查超时时间
+	checkTimeout = 3 * time.Second
+)
+
+// Register 注册检查项
+func Register(name string, critical bool, fn CheckFunc) {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+
+	checks = append(checks, Check{Name: name, Critical: critical, Fn: fn})
+}
+
+// SetTimeout 设置单项检查超时时间
+func SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		checkTimeout = timeout
+	}
+}
+
+// Run 并发执行检查，criticalOnly为true时只执行关键检查
+func Run(ctx context.Context, criticalOnly bool) Report {
+	checksMutex.RLock()
+	selected := make([]Check, 0, len(checks))
+	for _, check := range checks {
+		if criticalOnly && !check.Critical {
+			continue
+		}
+		selected = append(selected, check)
+	}
+	checksMutex.RUnlock()
+
+	reports := make([]CheckReport, len(selected))
+	var wg sync.WaitGroup
+	for i, check := range selected {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			reports[i] = runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:    StatusPass,
+		Ready:     true,
+		CheckedAt: time.Now(),
+		Checks:    reports,
+	}
+	for _, r := range reports {
+		if r.Status == StatusFail && r.Critical {
+			report.Ready = false
+		}
+		report.Status = worse(report.Status, r.Status)
+	}
+
+	return report
+}
+
+// runCheck 执行单项检查并记录耗时
+func runCheck(ctx context.Context, check Check) CheckReport {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	done := make(chan Result, 1)
+	go func() {
+		done <- check.Fn(ctx)
+	}()
+
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = Result{Status: StatusFail, Message: "检查超时"}
+	}
+
+	return CheckReport{
+		Name:      check.Name,
+		Status:    result.Status,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(startedAt)) / float64(time.Millisecond),
+		Message:   result.Message,
+		Details:   result.Details,
+	}
+}
+
+// worse 返回两个状态中较差的一个
+func worse(a, b Status) Status {
+	rank := map[Status]int{StatusPass: 0, StatusWarn: 1, StatusFail: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
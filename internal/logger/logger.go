@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"PushServer/internal/config"
+	"PushServer/internal/redact"
 	"github.com/sirupsen/logrus"
 )
 
@@ -42,6 +43,9 @@ func InitLogger() error {
 		}
 	}
 
+	// 输出前对日志内容脱敏
+	formatter = &redactingFormatter{Formatter: formatter}
+
 	if strings.ToLower(config.AppConfig.Log.Output) == "file" {
 		// 确保日志目录存在
 		logDir := filepath.Dir(config.AppConfig.Log.FilePath)
@@ -98,6 +102,31 @@ func InitLogger() error {
 	return nil
 }
 
+// redactingFormatter 对日志消息和字符串字段脱敏的格式化器
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+// Format 脱敏后交给原格式化器输出
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = redact.String(entry.Message)
+	if len(entry.Data) > 0 {
+		redacted.Data = make(logrus.Fields, len(entry.Data))
+		for key, value := range entry.Data {
+			switch v := value.(type) {
+			case string:
+				redacted.Data[key] = redact.String(v)
+			case error:
+				redacted.Data[key] = redact.String(v.Error())
+			default:
+				redacted.Data[key] = value
+			}
+		}
+	}
+	return f.Formatter.Format(&redacted)
+}
+
 // Info 记录信息日志
 func Info(args ...interface{}) {
 	if InfoLogger != nil {
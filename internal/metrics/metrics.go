@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pushserver"
+
+// Registry 指标注册表
+var Registry = prometheus.NewRegistry()
+
+var (
+	// PushTotal 推送次数，按接收者、平台、webhook和状态区分
+	PushTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "push_total",
+		Help:      "推送次数",
+	}, []string{"recipient", "platform", "webhook", "status"})
+
+	// PushDuration 各平台发送耗时
+	PushDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "push_duration_seconds",
+		Help:      "各平台发送耗时(秒)",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"platform"})
+
+	// SMTPRelaySessionsTotal SMTP中继会话总数
+	SMTPRelaySessionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "smtp_relay",
+		Name:      "sessions_total",
+		Help:      "SMTP中继会话总数",
+	})
+
+	// SMTPRelayActiveSessions 当前SMTP中继会话数
+	SMTPRelayActiveSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "smtp_relay",
+		Name:      "active_sessions",
+		Help:      "当前SMTP中继会话数",
+	})
+
+	// SMTPRelayMessagesTotal 各SMTP账户发送邮件数，按状态区分
+	SMTPRelayMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "smtp_relay",
+		Name:      "messages_total",
+		Help:      "各SMTP账户发送邮件数",
+	}, []string{"account", "status"})
+
+	// SMTPRelaySendDuration 各SMTP账户发送耗时
+	SMTPRelaySendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "smtp_relay",
+		Name:      "send_duration_seconds",
+		Help:      "各SMTP账户发送耗时(秒)",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"account"})
+
+	// SMTPRelayDeliveryFailuresTotal 所有账户均发送失败的邮件数
+	SMTPRelayDeliveryFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "smtp_relay",
+		Name:      "delivery_failures_total",
+		Help:      "所有SMTP账户均发送失败的邮件数",
+	})
+
+	// SMTPRelaySpoolMessages SMTP中继队列中等待投递的邮件数
+	SMTPRelaySpoolMessages = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "smtp_relay",
+		Name:      "spool_messages",
+		Help:      "SMTP中继队列中等待投递的邮件数",
+	})
+
+	// RateLimitedTotal 被限流拒绝的推送请求数，按限流维度区分
+	RateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "被限流拒绝的推送请求数",
+	}, []string{"dimension"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		PushTotal,
+		PushDuration,
+		SMTPRelaySessionsTotal,
+		SMTPRelayActiveSessions,
+		SMTPRelayMessagesTotal,
+		SMTPRelaySendDuration,
+		SMTPRelayDeliveryFailuresTotal,
+		SMTPRelaySpoolMessages,
+		RateLimitedTotal,
+	)
+}
+
+// NewDesc 创建指标描述
+func NewDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
+
+// Handler 返回指标导出的HTTP处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
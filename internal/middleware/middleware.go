@@ -1,7 +1,19 @@
 package middleware
 
 import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"PushServer/internal/audit"
+	"PushServer/internal/auth"
+	"PushServer/internal/config"
 	"PushServer/internal/logger"
+	"PushServer/internal/ratelimit"
+	"PushServer/internal/redact"
 	"github.com/gin-gonic/gin"
 )
 
@@ -31,23 +43,362 @@ func Recovery() gin.HandlerFunc {
 	})
 }
 
+// 默认的跨域方法和请求头
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-API-Key"}
+)
+
 // CORS 跨域中间件
-func CORS() gin.HandlerFunc {
+// 仅对allowed_origins中的来源返回跨域响应头，未配置时不允许跨域访问
+func CORS(corsConfig config.CORSConfig) gin.HandlerFunc {
+	allowAny := false
+	origins := make(map[string]bool)
+	for _, origin := range corsConfig.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+			continue
+		}
+		origins[strings.TrimRight(strings.ToLower(origin), "/")] = true
+	}
+
+	// 允许任意来源时不能携带凭证，否则等同于信任所有网站
+	allowCredentials := corsConfig.AllowCredentials && !allowAny
+	if corsConfig.AllowCredentials && allowAny {
+		logger.Warn("CORS允许任意来源时不支持allow_credentials，已忽略该配置")
+	}
+
+	methods := corsConfig.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := corsConfig.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(corsConfig.ExposedHeaders, ", ")
+
 	return func(c *gin.Context) {
-		method := c.Request.Method
 		origin := c.Request.Header.Get("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Origin")
+		allowed := allowAny || origins[strings.TrimRight(strings.ToLower(origin), "/")]
+		preflight := c.Request.Method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(403)
+				return
+			}
+			c.Next()
+			return
+		}
 
-		c.Header("Access-Control-Allow-Origin", origin)
-		c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token,X-Token,X-User-Id")
-		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE, PUT")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
+		if allowAny {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", exposeHeaders)
+		}
 
-		if method == "OPTIONS" {
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", allowMethods)
+			c.Header("Access-Control-Allow-Headers", allowHeaders)
+			if corsConfig.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(corsConfig.MaxAge))
+			}
 			c.AbortWithStatus(204)
 			return
 		}
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// IPFilter IP访问控制中间件
+// 规则支持单个IP或CIDR，命中deny时拒绝；配置了allow时仅允许命中allow的地址
+func IPFilter(group string, rule config.IPRuleConfig) gin.HandlerFunc {
+	allow := parseIPNets(group, rule.Allow)
+	deny := parseIPNets(group, rule.Deny)
+
+	return func(c *gin.Context) {
+		if len(allow) == 0 && len(deny) == 0 {
+			c.Next()
+			return
+		}
+
+		clientIP := c.ClientIP()
+		ip := net.ParseIP(clientIP)
+		if ip == nil || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+			logger.Warnf("IP访问控制拒绝请求: %s %s, 路由组: %s, 来源: %s", c.Request.Method, c.Request.URL.Path, group, clientIP)
+			audit.Record("anonymous", audit.ActionAccessDenied, c.Request.Method+" "+c.FullPath(), clientIP, audit.ResultDenied,
+				map[string]interface{}{"reason": "ip_filter", "group": group})
+			c.AbortWithStatusJSON(403, gin.H{
+				"code":    403,
+				"message": "来源IP不允许访问",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// parseIPNets 解析IP或CIDR列表，无效项记录错误后忽略
+func parseIPNets(group string, entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				if ip.To4() != nil {
+					entry += "/32"
+				} else {
+					entry += "/128"
+				}
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Errorf("路由组 %s 的IP规则 %q 无效，已忽略", group, entry)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// containsIP 检查IP是否命中任一网段
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSignedBodySize 签名请求体的最大长度
+const maxSignedBodySize = 10 << 20
+
+// Authenticate 认证中间件
+// 携带X-Push-Signature请求头时按HMAC签名校验；未携带密钥但使用了已校验的客户端证书时按mTLS映射权限；
+// 否则从Authorization: Bearer或X-API-Key请求头中读取API密钥或JWT令牌
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.Enabled() {
+			c.Next()
+			return
+		}
+
+		var principal *auth.Principal
+		switch {
+		case c.GetHeader(auth.HeaderSignature) != "":
+			principal = authenticateHMAC(c)
+		case !hasCredentials(c) && hasClientCertificate(c):
+			principal = authenticateCertificate(c)
+		default:
+			principal = authenticateBearer(c)
+		}
+		if principal == nil {
+			return
+		}
+
+		c.Set(auth.ContextKey, principal)
+		c.Next()
+	}
+}
+
+// hasCredentials 检查请求是否携带了API密钥或Bearer令牌
+func hasCredentials(c *gin.Context) bool {
+	return c.GetHeader("X-API-Key") != "" || c.GetHeader("Authorization") != ""
+}
+
+// hasClientCertificate 检查是否为已通过校验的mTLS连接
+func hasClientCertificate(c *gin.Context) bool {
+	return c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0
+}
+
+// authenticateCertificate 根据客户端证书匹配权限，失败时中止请求并返回nil
+func authenticateCertificate(c *gin.Context) *auth.Principal {
+	cert := c.Request.TLS.VerifiedChains[0][0]
+	principal, ok := auth.AuthenticateCertificate(cert)
+	if !ok {
+		logger.Warnf("客户端证书未配置权限映射: CN=%s, %s %s, 来源: %s", cert.Subject.CommonName, c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		abortUnauthorized(c, "客户端证书未授权")
+		return nil
+	}
+	return principal
+}
+
+// authenticateBearer 校验API密钥或JWT令牌，失败时中止请求并返回nil
+func authenticateBearer(c *gin.Context) *auth.Principal {
+	key := c.GetHeader("X-API-Key")
+	bearer := false
+	if key == "" {
+		if authorization := c.GetHeader("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			key = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+			bearer = true
+		}
+	}
+
+	if key == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="PushServer"`)
+		abortUnauthorized(c, "缺少认证信息")
+		return nil
+	}
+
+	if bearer && auth.JWTEnabled() && auth.LooksLikeJWT(key) {
+		principal, err := auth.AuthenticateJWT(key)
+		if err != nil {
+			logger.Warnf("JWT认证失败: %s %s, 来源: %s, 原因: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			c.Header("WWW-Authenticate", `Bearer realm="PushServer", error="invalid_token"`)
+			abortUnauthorized(c, "令牌无效")
+			return nil
+		}
+		return principal
+	}
+
+	principal, ok := auth.AuthenticateAPIKey(key)
+	if !ok {
+		logger.Warnf("API密钥认证失败: %s %s, 来源: %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		c.Header("WWW-Authenticate", `Bearer realm="PushServer", error="invalid_token"`)
+		abortUnauthorized(c, "认证失败")
+		return nil
+	}
+
+	return principal
+}
+
+// authenticateHMAC 校验HMAC请求签名，失败时中止请求并返回nil
+func authenticateHMAC(c *gin.Context) *auth.Principal {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+	if err != nil {
+		abortUnauthorized(c, "读取请求体失败")
+		return nil
+	}
+	// 还原请求体供后续处理器读取
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	principal, err := auth.AuthenticateHMAC(auth.SignedRequest{
+		KeyID:     c.GetHeader(auth.HeaderKeyID),
+		Timestamp: c.GetHeader(auth.HeaderTimestamp),
+		Nonce:     c.GetHeader(auth.HeaderNonce),
+		Signature: c.GetHeader(auth.HeaderSignature),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.RequestURI(),
+		Body:      body,
+	})
+	if err != nil {
+		logger.Warnf("HMAC签名认证失败: %s %s, 密钥ID: %s, 来源: %s, 原因: %v",
+			c.Request.Method, c.Request.URL.Path, c.GetHeader(auth.HeaderKeyID), c.ClientIP(), err)
+		abortUnauthorized(c, "签名认证失败: "+err.Error())
+		return nil
+	}
+
+	return principal
+}
+
+// abortUnauthorized 中止请求并返回401
+func abortUnauthorized(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(401, gin.H{
+		"code":    401,
+		"message": message,
+	})
+}
+
+// redactingWriter 缓存响应体，在处理器返回后统一脱敏输出
+type redactingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *redactingWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *redactingWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Redact 响应脱敏中间件，对接口返回内容中的令牌、密码和邮箱地址脱敏
+func Redact() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &redactingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		c.Writer = writer.ResponseWriter
+		if writer.body.Len() > 0 {
+			c.Writer.Write(redact.Bytes(writer.body.Bytes()))
+		}
+	}
+}
+
+// RateLimit 推送接口限流中间件，按来源IP和调用方限流，需在认证之后使用
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ratelimit.Enabled() {
+			c.Next()
+			return
+		}
+
+		if allowed, wait := ratelimit.Allow(ratelimit.DimensionIP, c.ClientIP()); !allowed {
+			ratelimit.Abort(c, ratelimit.DimensionIP, c.ClientIP(), wait)
+			return
+		}
+
+		if principal := auth.FromContext(c); principal != nil {
+			if allowed, wait := ratelimit.Allow(ratelimit.DimensionKey, principal.String()); !allowed {
+				ratelimit.Abort(c, ratelimit.DimensionKey, principal.String(), wait)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission 权限校验中间件，拥有任一指定权限即可访问
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.Enabled() {
+			c.Next()
+			return
+		}
+
+		principal := auth.FromContext(c)
+		if principal == nil {
+			abortUnauthorized(c, "缺少认证信息")
+			return
+		}
+
+		for _, permission := range permissions {
+			if principal.HasPermission(permission) {
+				c.Next()
+				return
+			}
+		}
+
+		logger.Warnf("权限不足: %s 访问 %s %s", principal, c.Request.Method, c.Request.URL.Path)
+		audit.Record(principal.String(), audit.ActionAccessDenied, c.Request.Method+" "+c.FullPath(), c.ClientIP(), audit.ResultDenied,
+			map[string]interface{}{"required": permissions})
+		c.AbortWithStatusJSON(403, gin.H{
+			"code":    403,
+			"message": "权限不足",
+		})
+	}
+}
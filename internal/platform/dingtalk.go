@@ -2,6 +2,7 @@ package platform
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -14,6 +15,7 @@ import (
 	"PushServer/internal/config"
 	"PushServer/internal/logger"
 	"PushServer/internal/model"
+	"PushServer/internal/tracing"
 )
 
 // DingtalkPlatform 钉钉平台
@@ -25,7 +27,7 @@ func NewDingtalkPlatform() *DingtalkPlatform {
 }
 
 // Send 发送消息到钉钉
-func (d *DingtalkPlatform) Send(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+func (d *DingtalkPlatform) Send(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
 	logger.Infof("开始转发到钉钉: %s, 类型: %s, 样式: %s", webhook.Name, req.Type, req.Style)
 
 	var payload interface{}
@@ -38,7 +40,7 @@ func (d *DingtalkPlatform) Send(webhook config.WebhookConfig, req model.PushRequ
 	}
 
 	// 发送HTTP请求
-	result := d.sendHTTPRequest(webhook, payload)
+	result := d.sendHTTPRequest(ctx, webhook, payload)
 
 	if result.Status == "success" {
 		logger.Infof("钉钉转发成功: %s", webhook.Name)
@@ -112,7 +114,7 @@ func (d *DingtalkPlatform) buildCardMessage(req model.PushRequest) map[string]in
 }
 
 // sendHTTPRequest 发送HTTP请求
-func (d *DingtalkPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload interface{}) PlatformResult {
+func (d *DingtalkPlatform) sendHTTPRequest(ctx context.Context, webhook config.WebhookConfig, payload interface{}) PlatformResult {
 	result := PlatformResult{
 		Platform:  "dingtalk",
 		Webhook:   webhook.Name,
@@ -136,7 +138,7 @@ func (d *DingtalkPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload
 	}
 
 	// 创建HTTP请求
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		result.Status = "failed"
 		result.Message = fmt.Sprintf("创建HTTP请求失败: %v", err)
@@ -146,9 +148,7 @@ func (d *DingtalkPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload
 	req.Header.Set("Content-Type", "application/json")
 
 	// 发送请求
-	client := &http.Client{
-		Timeout: time.Duration(config.AppConfig.Queue.Timeout) * time.Second,
-	}
+	client := tracing.NewHTTPClient(time.Duration(config.AppConfig.Queue.Timeout) * time.Second)
 
 	resp, err := client.Do(req)
 	if err != nil {
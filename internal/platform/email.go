@@ -1,11 +1,13 @@
 package platform
 
 import (
+	"context"
 	"fmt"
 	"net/smtp"
 	"time"
 
 	"PushServer/internal/config"
+	"PushServer/internal/dkim"
 	"PushServer/internal/logger"
 	"PushServer/internal/model"
 	smtpRelay "PushServer/internal/smtp"
@@ -20,7 +22,7 @@ func NewEmailPlatform() *EmailPlatform {
 }
 
 // Send 发送邮件
-func (e *EmailPlatform) Send(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+func (e *EmailPlatform) Send(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
 	logger.Infof("开始发送邮件: %s, 类型: %s, 样式: %s", webhook.Name, req.Type, req.Style)
 
 	// 检查是否启用SMTP中继
@@ -106,12 +108,19 @@ func (e *EmailPlatform) sendViaSMTP(webhook config.WebhookConfig, req model.Push
 	}
 	message += "\r\n" + body
 
+	// 按From域名进行DKIM签名
+	signed, err := dkim.Sign([]byte(message))
+	if err != nil {
+		logger.Warnf("邮件DKIM签名失败，将发送未签名的邮件: %s, 错误: %v", webhook.Name, err)
+		signed = []byte(message)
+	}
+
 	// SMTP认证
 	auth := smtp.PlainAuth("", config.AppConfig.Email.Username, config.AppConfig.Email.Password, config.AppConfig.Email.SMTPHost)
 
 	// 发送邮件
 	addr := fmt.Sprintf("%s:%d", config.AppConfig.Email.SMTPHost, config.AppConfig.Email.SMTPPort)
-	err := smtp.SendMail(addr, auth, config.AppConfig.Email.From, []string{webhook.URL}, []byte(message))
+	err = smtp.SendMail(addr, auth, config.AppConfig.Email.From, []string{webhook.URL}, signed)
 
 	if err != nil {
 		result.Status = "failed"
@@ -2,6 +2,7 @@ package platform
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -13,6 +14,7 @@ import (
 	"PushServer/internal/config"
 	"PushServer/internal/logger"
 	"PushServer/internal/model"
+	"PushServer/internal/tracing"
 )
 
 // FeishuPlatform 飞书平台
@@ -24,7 +26,7 @@ func NewFeishuPlatform() *FeishuPlatform {
 }
 
 // Send 发送消息到飞书
-func (f *FeishuPlatform) Send(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+func (f *FeishuPlatform) Send(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
 	logger.Infof("开始转发到飞书: %s, 类型: %s, 样式: %s", webhook.Name, req.Type, req.Style)
 
 	var payload interface{}
@@ -37,7 +39,7 @@ func (f *FeishuPlatform) Send(webhook config.WebhookConfig, req model.PushReques
 	}
 
 	// 发送HTTP请求
-	result := f.sendHTTPRequest(webhook, payload)
+	result := f.sendHTTPRequest(ctx, webhook, payload)
 
 	if result.Status == "success" {
 		logger.Infof("飞书转发成功: %s", webhook.Name)
@@ -159,7 +161,7 @@ func (f *FeishuPlatform) buildCardMessage(req model.PushRequest, webhook config.
 }
 
 // sendHTTPRequest 发送HTTP请求
-func (f *FeishuPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload interface{}) PlatformResult {
+func (f *FeishuPlatform) sendHTTPRequest(ctx context.Context, webhook config.WebhookConfig, payload interface{}) PlatformResult {
 	result := PlatformResult{
 		Platform:  "feishu",
 		Webhook:   webhook.Name,
@@ -175,7 +177,7 @@ func (f *FeishuPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload i
 	}
 
 	// 创建HTTP请求
-	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		result.Status = "failed"
 		result.Message = fmt.Sprintf("创建HTTP请求失败: %v", err)
@@ -185,9 +187,7 @@ func (f *FeishuPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload i
 	req.Header.Set("Content-Type", "application/json")
 
 	// 发送请求
-	client := &http.Client{
-		Timeout: time.Duration(config.AppConfig.Queue.Timeout) * time.Second,
-	}
+	client := tracing.NewHTTPClient(time.Duration(config.AppConfig.Queue.Timeout) * time.Second)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -1,6 +1,7 @@
 package platform
 
 import (
+	"context"
 	"time"
 
 	"PushServer/internal/config"
@@ -10,7 +11,7 @@ import (
 // Platform 平台接口
 type Platform interface {
 	// Send 发送消息到平台
-	Send(webhook config.WebhookConfig, req model.PushRequest) PlatformResult
+	Send(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult
 	// GetName 获取平台名称
 	GetName() string
 }
@@ -62,7 +63,7 @@ func (pm *PlatformManager) GetAllPlatforms() map[string]Platform {
 }
 
 // Send 发送消息到指定平台
-func (pm *PlatformManager) Send(platformName string, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+func (pm *PlatformManager) Send(ctx context.Context, platformName string, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
 	platform, exists := pm.GetPlatform(platformName)
 	if !exists {
 		return PlatformResult{
@@ -74,30 +75,30 @@ func (pm *PlatformManager) Send(platformName string, webhook config.WebhookConfi
 		}
 	}
 
-	return platform.Send(webhook, req)
+	return platform.Send(ctx, webhook, req)
 }
 
 // ForwardToFeishu 转发到飞书
-func (pm *PlatformManager) ForwardToFeishu(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
-	return pm.Send("feishu", webhook, req)
+func (pm *PlatformManager) ForwardToFeishu(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+	return pm.Send(ctx, "feishu", webhook, req)
 }
 
 // ForwardToDingtalk 转发到钉钉
-func (pm *PlatformManager) ForwardToDingtalk(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
-	return pm.Send("dingtalk", webhook, req)
+func (pm *PlatformManager) ForwardToDingtalk(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+	return pm.Send(ctx, "dingtalk", webhook, req)
 }
 
 // ForwardToWorkWechat 转发到企业微信
-func (pm *PlatformManager) ForwardToWorkWechat(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
-	return pm.Send("wechat", webhook, req)
+func (pm *PlatformManager) ForwardToWorkWechat(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+	return pm.Send(ctx, "wechat", webhook, req)
 }
 
 // ForwardToEmail 转发到邮件
-func (pm *PlatformManager) ForwardToEmail(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
-	return pm.Send("email", webhook, req)
+func (pm *PlatformManager) ForwardToEmail(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+	return pm.Send(ctx, "email", webhook, req)
 }
 
 // ForwardToSystem 转发到系统通知
-func (pm *PlatformManager) ForwardToSystem(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
-	return pm.Send("system", webhook, req)
+func (pm *PlatformManager) ForwardToSystem(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+	return pm.Send(ctx, "system", webhook, req)
 }
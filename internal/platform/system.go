@@ -1,6 +1,7 @@
 package platform
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,7 +23,7 @@ func NewSystemPlatform() *SystemPlatform {
 }
 
 // Send 发送系统通知
-func (s *SystemPlatform) Send(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+func (s *SystemPlatform) Send(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
 	logger.Infof("开始发送系统通知: %s, 类型: %s, 样式: %s", webhook.Name, req.Type, req.Style)
 
 	// 根据配置的通知方式发送
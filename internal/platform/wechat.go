@@ -2,6 +2,7 @@ package platform
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
@@ -12,6 +13,7 @@ import (
 	"PushServer/internal/config"
 	"PushServer/internal/logger"
 	"PushServer/internal/model"
+	"PushServer/internal/tracing"
 )
 
 // WechatPlatform 企业微信平台
@@ -23,7 +25,7 @@ func NewWechatPlatform() *WechatPlatform {
 }
 
 // Send 发送消息到企业微信
-func (w *WechatPlatform) Send(webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
+func (w *WechatPlatform) Send(ctx context.Context, webhook config.WebhookConfig, req model.PushRequest) PlatformResult {
 	logger.Infof("开始转发到企业微信: %s, 类型: %s, 样式: %s", webhook.Name, req.Type, req.Style)
 
 	var payload interface{}
@@ -36,7 +38,7 @@ func (w *WechatPlatform) Send(webhook config.WebhookConfig, req model.PushReques
 	}
 
 	// 发送HTTP请求
-	result := w.sendHTTPRequest(webhook, payload)
+	result := w.sendHTTPRequest(ctx, webhook, payload)
 
 	if result.Status == "success" {
 		logger.Infof("企业微信转发成功: %s", webhook.Name)
@@ -104,7 +106,7 @@ func (w *WechatPlatform) buildCardMessage(req model.PushRequest) map[string]inte
 }
 
 // sendHTTPRequest 发送HTTP请求
-func (w *WechatPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload interface{}) PlatformResult {
+func (w *WechatPlatform) sendHTTPRequest(ctx context.Context, webhook config.WebhookConfig, payload interface{}) PlatformResult {
 	result := PlatformResult{
 		Platform:  "wechat",
 		Webhook:   webhook.Name,
@@ -120,7 +122,7 @@ func (w *WechatPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload i
 	}
 
 	// 创建HTTP请求
-	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		result.Status = "failed"
 		result.Message = fmt.Sprintf("创建HTTP请求失败: %v", err)
@@ -137,9 +139,7 @@ func (w *WechatPlatform) sendHTTPRequest(webhook config.WebhookConfig, payload i
 	}
 
 	// 发送请求
-	client := &http.Client{
-		Timeout: time.Duration(config.AppConfig.Queue.Timeout) * time.Second,
-	}
+	client := tracing.NewHTTPClient(time.Duration(config.AppConfig.Queue.Timeout) * time.Second)
 
 	resp, err := client.Do(req)
 	if err != nil {
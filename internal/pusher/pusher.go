@@ -1,15 +1,23 @@
 package pusher
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	"PushServer/internal/config"
 	"PushServer/internal/logger"
+	"PushServer/internal/metrics"
 	"PushServer/internal/model"
 	"PushServer/internal/platform"
+	"PushServer/internal/statistics"
 	"PushServer/internal/task"
+	"PushServer/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PushService 推送服务
@@ -25,11 +33,21 @@ func NewPushService() *PushService {
 }
 
 // ExecuteStrategy 执行推送策略
-func (ps *PushService) ExecuteStrategy(taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+func (ps *PushService) ExecuteStrategy(ctx context.Context, taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+	ctx, span := tracing.Tracer().Start(ctx, "pusher.ExecuteStrategy", trace.WithAttributes(
+		attribute.String("push.task_id", taskID),
+		attribute.String("push.recipient", req.RecipientAlias),
+		attribute.String("push.strategy", req.Strategy),
+		attribute.String("push.platform", req.Platform),
+	))
+	defer span.End()
+
+	statistics.Manager.RecordTask()
+
 	// 如果指定了平台，直接忽略策略，只在该平台内推送直到成功
 	if req.Platform != "" {
 		logger.Infof("指定平台推送: %s, 任务ID: %s (忽略策略: %s)", req.Platform, taskID, req.Strategy)
-		ps.executePlatformOnlyStrategy(taskID, req, recipient)
+		ps.executePlatformOnlyStrategy(ctx, taskID, req, recipient)
 		return
 	}
 
@@ -37,20 +55,20 @@ func (ps *PushService) ExecuteStrategy(taskID string, req model.PushRequest, rec
 
 	switch req.Strategy {
 	case model.StrategyAll:
-		ps.executeAllStrategy(taskID, req, recipient)
+		ps.executeAllStrategy(ctx, taskID, req, recipient)
 	case model.StrategyFailover:
-		ps.executeFailoverStrategy(taskID, req, recipient)
+		ps.executeFailoverStrategy(ctx, taskID, req, recipient)
 	case model.StrategyWebhookFailover:
-		ps.executeWebhookFailoverStrategy(taskID, req, recipient)
+		ps.executeWebhookFailoverStrategy(ctx, taskID, req, recipient)
 	case model.StrategyMixed:
-		ps.executeMixedStrategy(taskID, req, recipient)
+		ps.executeMixedStrategy(ctx, taskID, req, recipient)
 	default:
 		task.Manager.SetTaskError(taskID, "不支持的推送策略: "+req.Strategy)
 	}
 }
 
 // executePlatformOnlyStrategy 执行指定平台推送：忽略策略，只在指定平台内推送直到成功
-func (ps *PushService) executePlatformOnlyStrategy(taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+func (ps *PushService) executePlatformOnlyStrategy(ctx context.Context, taskID string, req model.PushRequest, recipient config.RecipientConfig) {
 	logger.Infof("执行指定平台推送: %s，只要有一个地址成功即可", req.Platform)
 
 	platformConfig, exists := recipient.Platforms[req.Platform]
@@ -73,7 +91,7 @@ func (ps *PushService) executePlatformOnlyStrategy(taskID string, req model.Push
 				Secret: "",
 				Name:   recipient.Name,
 			}
-			result := ps.sendToWebhook(req.Platform, webhook, req)
+			result := ps.sendToWebhook(ctx, req.Platform, webhook, req)
 			task.Manager.AddResult(taskID, result)
 			logger.Infof("指定平台推送结果: %s-%s: %s", req.Platform, recipient.Name, result.Status)
 
@@ -91,7 +109,7 @@ func (ps *PushService) executePlatformOnlyStrategy(taskID string, req model.Push
 				Secret: "",
 				Name:   notification.Name,
 			}
-			result := ps.sendToWebhook(req.Platform, webhook, req)
+			result := ps.sendToWebhook(ctx, req.Platform, webhook, req)
 			task.Manager.AddResult(taskID, result)
 			logger.Infof("指定平台推送结果: %s-%s: %s", req.Platform, notification.Name, result.Status)
 
@@ -104,7 +122,7 @@ func (ps *PushService) executePlatformOnlyStrategy(taskID string, req model.Push
 	} else {
 		// 其他平台使用webhooks配置
 		for _, webhook := range platformConfig.Webhooks {
-			result := ps.sendToWebhook(req.Platform, webhook, req)
+			result := ps.sendToWebhook(ctx, req.Platform, webhook, req)
 			task.Manager.AddResult(taskID, result)
 			logger.Infof("指定平台推送结果: %s-%s: %s", req.Platform, webhook.Name, result.Status)
 
@@ -119,11 +137,11 @@ func (ps *PushService) executePlatformOnlyStrategy(taskID string, req model.Push
 	logger.Warnf("指定平台 %s 所有地址都推送失败，任务ID: %s", req.Platform, taskID)
 
 	// 触发系统通知作为最后防线
-	ps.triggerSystemNotification(taskID, req, fmt.Sprintf("指定平台 %s 推送失败", req.Platform))
+	ps.triggerSystemNotification(ctx, taskID, req, fmt.Sprintf("指定平台 %s 推送失败", req.Platform))
 }
 
 // executeAllStrategy 执行all策略：所有渠道都发送
-func (ps *PushService) executeAllStrategy(taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+func (ps *PushService) executeAllStrategy(ctx context.Context, taskID string, req model.PushRequest, recipient config.RecipientConfig) {
 	logger.Infof("执行all策略：向所有启用的渠道发送消息")
 
 	var wg sync.WaitGroup
@@ -151,7 +169,7 @@ func (ps *PushService) executeAllStrategy(taskID string, req model.PushRequest,
 						Secret: "",
 						Name:   rec.Name,
 					}
-					result := ps.sendToWebhook(pName, webhook, req)
+					result := ps.sendToWebhook(ctx, pName, webhook, req)
 					task.Manager.AddResult(taskID, result)
 					logger.Infof("all策略推送结果: %s-%s: %s", pName, rec.Name, result.Status)
 				}(platformName, recipient)
@@ -170,7 +188,7 @@ func (ps *PushService) executeAllStrategy(taskID string, req model.PushRequest,
 						Secret: "",
 						Name:   notif.Name,
 					}
-					result := ps.sendToWebhook(pName, webhook, req)
+					result := ps.sendToWebhook(ctx, pName, webhook, req)
 					task.Manager.AddResult(taskID, result)
 					logger.Infof("all策略推送结果: %s-%s: %s", pName, notif.Name, result.Status)
 				}(platformName, notification)
@@ -184,7 +202,7 @@ func (ps *PushService) executeAllStrategy(taskID string, req model.PushRequest,
 					semaphore <- struct{}{}        // 获取信号量
 					defer func() { <-semaphore }() // 释放信号量
 
-					result := ps.sendToWebhook(pName, wh, req)
+					result := ps.sendToWebhook(ctx, pName, wh, req)
 					task.Manager.AddResult(taskID, result)
 					logger.Infof("all策略推送结果: %s-%s: %s", pName, wh.Name, result.Status)
 				}(platformName, webhook)
@@ -196,11 +214,11 @@ func (ps *PushService) executeAllStrategy(taskID string, req model.PushRequest,
 	logger.Infof("all策略执行完成，任务ID: %s", taskID)
 
 	// 检查是否有成功的推送，如果全部失败则触发系统通知
-	ps.checkAndTriggerSystemNotification(taskID, req, "all策略所有渠道推送失败")
+	ps.checkAndTriggerSystemNotification(ctx, taskID, req, "all策略所有渠道推送失败")
 }
 
 // executeFailoverStrategy 执行failover策略：渠道间故障转移
-func (ps *PushService) executeFailoverStrategy(taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+func (ps *PushService) executeFailoverStrategy(ctx context.Context, taskID string, req model.PushRequest, recipient config.RecipientConfig) {
 	logger.Infof("执行failover策略：渠道间故障转移")
 
 	for platformName, platformConfig := range recipient.Platforms {
@@ -219,7 +237,7 @@ func (ps *PushService) executeFailoverStrategy(taskID string, req model.PushRequ
 					Secret: "",
 					Name:   recipient.Name,
 				}
-				result := ps.sendToWebhook(platformName, webhook, req)
+				result := ps.sendToWebhook(ctx, platformName, webhook, req)
 				task.Manager.AddResult(taskID, result)
 				logger.Infof("failover策略推送结果: %s-%s: %s", platformName, recipient.Name, result.Status)
 
@@ -233,7 +251,7 @@ func (ps *PushService) executeFailoverStrategy(taskID string, req model.PushRequ
 			// 其他平台使用webhooks配置
 			if len(platformConfig.Webhooks) > 0 {
 				webhook := platformConfig.Webhooks[0]
-				result := ps.sendToWebhook(platformName, webhook, req)
+				result := ps.sendToWebhook(ctx, platformName, webhook, req)
 				task.Manager.AddResult(taskID, result)
 				logger.Infof("failover策略推送结果: %s-%s: %s", platformName, webhook.Name, result.Status)
 
@@ -249,11 +267,11 @@ func (ps *PushService) executeFailoverStrategy(taskID string, req model.PushRequ
 	logger.Infof("failover策略执行完成，任务ID: %s", taskID)
 
 	// 检查是否有成功的推送，如果全部失败则触发系统通知
-	ps.checkAndTriggerSystemNotification(taskID, req, "failover策略所有渠道推送失败")
+	ps.checkAndTriggerSystemNotification(ctx, taskID, req, "failover策略所有渠道推送失败")
 }
 
 // executeWebhookFailoverStrategy 执行webhook_failover策略：每个渠道内webhook故障转移
-func (ps *PushService) executeWebhookFailoverStrategy(taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+func (ps *PushService) executeWebhookFailoverStrategy(ctx context.Context, taskID string, req model.PushRequest, recipient config.RecipientConfig) {
 	logger.Infof("执行webhook_failover策略：每个渠道内webhook故障转移")
 
 	for platformName, platformConfig := range recipient.Platforms {
@@ -272,7 +290,7 @@ func (ps *PushService) executeWebhookFailoverStrategy(taskID string, req model.P
 					Secret: "",
 					Name:   recipient.Name,
 				}
-				result := ps.sendToWebhook(platformName, webhook, req)
+				result := ps.sendToWebhook(ctx, platformName, webhook, req)
 				task.Manager.AddResult(taskID, result)
 				logger.Infof("webhook_failover策略推送结果: %s-%s: %s", platformName, recipient.Name, result.Status)
 
@@ -286,7 +304,7 @@ func (ps *PushService) executeWebhookFailoverStrategy(taskID string, req model.P
 		} else {
 			// 其他平台使用webhooks配置
 			for _, webhook := range platformConfig.Webhooks {
-				result := ps.sendToWebhook(platformName, webhook, req)
+				result := ps.sendToWebhook(ctx, platformName, webhook, req)
 				task.Manager.AddResult(taskID, result)
 				logger.Infof("webhook_failover策略推送结果: %s-%s: %s", platformName, webhook.Name, result.Status)
 
@@ -307,11 +325,11 @@ func (ps *PushService) executeWebhookFailoverStrategy(taskID string, req model.P
 	logger.Infof("webhook_failover策略执行完成，任务ID: %s", taskID)
 
 	// 检查是否有成功的推送，如果全部失败则触发系统通知
-	ps.checkAndTriggerSystemNotification(taskID, req, "webhook_failover策略所有渠道推送失败")
+	ps.checkAndTriggerSystemNotification(ctx, taskID, req, "webhook_failover策略所有渠道推送失败")
 }
 
 // executeMixedStrategy 执行mixed策略：渠道间故障转移，渠道内webhook全发送
-func (ps *PushService) executeMixedStrategy(taskID string, req model.PushRequest, recipient config.RecipientConfig) {
+func (ps *PushService) executeMixedStrategy(ctx context.Context, taskID string, req model.PushRequest, recipient config.RecipientConfig) {
 	logger.Infof("执行mixed策略：渠道间故障转移，渠道内webhook全发送")
 
 	for platformName, platformConfig := range recipient.Platforms {
@@ -341,7 +359,7 @@ func (ps *PushService) executeMixedStrategy(taskID string, req model.PushRequest
 						Secret: "",
 						Name:   rec.Name,
 					}
-					result := ps.sendToWebhook(platformName, webhook, req)
+					result := ps.sendToWebhook(ctx, platformName, webhook, req)
 					task.Manager.AddResult(taskID, result)
 					logger.Infof("mixed策略推送结果: %s-%s: %s", platformName, rec.Name, result.Status)
 
@@ -374,7 +392,7 @@ func (ps *PushService) executeMixedStrategy(taskID string, req model.PushRequest
 					semaphore <- struct{}{}        // 获取信号量
 					defer func() { <-semaphore }() // 释放信号量
 
-					result := ps.sendToWebhook(platformName, wh, req)
+					result := ps.sendToWebhook(ctx, platformName, wh, req)
 					task.Manager.AddResult(taskID, result)
 					logger.Infof("mixed策略推送结果: %s-%s: %s", platformName, wh.Name, result.Status)
 
@@ -410,26 +428,33 @@ func (ps *PushService) executeMixedStrategy(taskID string, req model.PushRequest
 	logger.Infof("mixed策略执行完成，任务ID: %s", taskID)
 
 	// 检查是否有成功的推送，如果全部失败则触发系统通知
-	ps.checkAndTriggerSystemNotification(taskID, req, "mixed策略所有渠道推送失败")
+	ps.checkAndTriggerSystemNotification(ctx, taskID, req, "mixed策略所有渠道推送失败")
 }
 
 // sendToWebhook 发送到webhook
-func (ps *PushService) sendToWebhook(platformName string, webhook config.WebhookConfig, req model.PushRequest) task.PushResult {
+func (ps *PushService) sendToWebhook(ctx context.Context, platformName string, webhook config.WebhookConfig, req model.PushRequest) task.PushResult {
 	logger.Infof("开始发送消息到 %s - %s: %s", platformName, webhook.Name, req.Content.Title)
 
+	ctx, span := tracing.Tracer().Start(ctx, "platform.Send", trace.WithAttributes(
+		attribute.String("push.platform", platformName),
+		attribute.String("push.webhook", webhook.Name),
+	))
+	defer span.End()
+
 	// 根据平台选择对应的转发服务
 	var result platform.PlatformResult
+	startedAt := time.Now()
 	switch platformName {
 	case "feishu":
-		result = ps.platformManager.ForwardToFeishu(webhook, req)
+		result = ps.platformManager.ForwardToFeishu(ctx, webhook, req)
 	case "dingtalk":
-		result = ps.platformManager.ForwardToDingtalk(webhook, req)
+		result = ps.platformManager.ForwardToDingtalk(ctx, webhook, req)
 	case "wechat":
-		result = ps.platformManager.ForwardToWorkWechat(webhook, req)
+		result = ps.platformManager.ForwardToWorkWechat(ctx, webhook, req)
 	case "email":
-		result = ps.platformManager.ForwardToEmail(webhook, req)
+		result = ps.platformManager.ForwardToEmail(ctx, webhook, req)
 	case "system":
-		result = ps.platformManager.ForwardToSystem(webhook, req)
+		result = ps.platformManager.ForwardToSystem(ctx, webhook, req)
 	default:
 		result = platform.PlatformResult{
 			Platform:  platformName,
@@ -439,6 +464,13 @@ func (ps *PushService) sendToWebhook(platformName string, webhook config.Webhook
 			Timestamp: time.Now(),
 		}
 	}
+	latency := time.Since(startedAt)
+	ps.recordMetrics(req.RecipientAlias, result, latency)
+
+	span.SetAttributes(attribute.String("push.status", result.Status))
+	if result.Status != "success" {
+		span.SetStatus(codes.Error, result.Message)
+	}
 
 	// 转换为任务结果格式
 	taskResult := task.PushResult{
@@ -448,12 +480,19 @@ func (ps *PushService) sendToWebhook(platformName string, webhook config.Webhook
 		Message:   result.Message,
 		Timestamp: result.Timestamp,
 	}
+	statistics.Manager.RecordResult(req.RecipientAlias, taskResult, latency)
 
 	return taskResult
 }
 
+// recordMetrics 记录推送指标
+func (ps *PushService) recordMetrics(recipientAlias string, result platform.PlatformResult, duration time.Duration) {
+	metrics.PushTotal.WithLabelValues(recipientAlias, result.Platform, result.Webhook, result.Status).Inc()
+	metrics.PushDuration.WithLabelValues(result.Platform).Observe(duration.Seconds())
+}
+
 // checkAndTriggerSystemNotification 检查推送结果并触发系统通知
-func (ps *PushService) checkAndTriggerSystemNotification(taskID string, req model.PushRequest, reason string) {
+func (ps *PushService) checkAndTriggerSystemNotification(ctx context.Context, taskID string, req model.PushRequest, reason string) {
 	// 获取任务结果
 	taskInfo, exists := task.Manager.GetTask(taskID)
 	if !exists || taskInfo == nil {
@@ -473,14 +512,16 @@ func (ps *PushService) checkAndTriggerSystemNotification(taskID string, req mode
 	// 如果没有成功的推送，触发系统通知
 	if !hasSuccess {
 		logger.Warnf("所有推送都失败，触发系统通知: %s", reason)
-		ps.triggerSystemNotification(taskID, req, reason)
+		ps.triggerSystemNotification(ctx, taskID, req, reason)
 	}
 }
 
 // triggerSystemNotification 触发系统通知
-func (ps *PushService) triggerSystemNotification(taskID string, req model.PushRequest, reason string) {
+func (ps *PushService) triggerSystemNotification(ctx context.Context, taskID string, req model.PushRequest, reason string) {
 	logger.Infof("触发系统通知作为最后防线，任务ID: %s, 原因: %s", taskID, reason)
 
+	statistics.Manager.RecordFallback()
+
 	// 检查是否启用了系统通知
 	if !config.AppConfig.System.Enabled {
 		logger.Infof("系统通知未启用，跳过系统通知")
@@ -521,7 +562,9 @@ func (ps *PushService) triggerSystemNotification(taskID string, req model.PushRe
 			Name:   notifyConfig.Name,
 		}
 
-		result := ps.platformManager.ForwardToSystem(webhook, systemReq)
+		startedAt := time.Now()
+		result := ps.platformManager.ForwardToSystem(ctx, webhook, systemReq)
+		ps.recordMetrics(req.RecipientAlias, result, time.Since(startedAt))
 		task.Manager.AddResult(taskID, task.PushResult{
 			Platform:  result.Platform,
 			Webhook:   result.Webhook,
@@ -3,31 +3,80 @@ package queue
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"PushServer/internal/config"
 	"PushServer/internal/logger"
 	"PushServer/internal/model"
 	"PushServer/internal/pusher"
 	"PushServer/internal/task"
+	"PushServer/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PushJob 推送任务
 type PushJob struct {
-	TaskID  string            `json:"task_id"`
-	Request model.PushRequest `json:"request"`
+	TaskID     string            `json:"task_id"`
+	Request    model.PushRequest `json:"request"`
+	EnqueuedAt time.Time         `json:"enqueued_at"`
+
+	// TraceContext 入队时的链路追踪上下文
+	TraceContext context.Context `json:"-"`
 }
 
 // Queue 队列结构
 type Queue struct {
 	jobs        chan PushJob
 	workers     int
+	capacity    int
 	ctx         context.Context
 	cancel      context.CancelFunc
 	wg          sync.WaitGroup
 	pushService *pusher.PushService
+
+	// 运行指标
+	aliveWorkers int64
+	busyWorkers  int64
+	processed    int64
+	rejected     int64
+
+	statsMutex    sync.RWMutex
+	avgWaitMs     float64 // 平均排队等待时间(毫秒)，指数加权平均
+	avgLatencyMs  float64 // 平均任务耗时(毫秒，入队到处理完成)，指数加权平均
+	drainRate     float64 // 出队速率(任务/秒)，指数加权平均
+	lastProcessed int64
 }
 
+// QueueStats 队列运行指标
+type QueueStats struct {
+	Depth        int     `json:"depth"`          // 当前排队任务数
+	Capacity     int     `json:"capacity"`       // 队列容量
+	Saturation   float64 `json:"saturation"`     // 队列饱和度(0-1)
+	Workers      int     `json:"workers"`        // 工作协程数
+	AliveWorkers int     `json:"alive_workers"`  // 存活的工作协程数
+	BusyWorkers  int     `json:"busy_workers"`   // 正在处理任务的工作协程数
+	Utilization  float64 `json:"utilization"`    // 工作协程利用率(0-1)
+	Processed    int64   `json:"processed"`      // 已处理任务数
+	Rejected     int64   `json:"rejected"`       // 被拒绝的任务数
+	AvgWaitMs    float64 `json:"avg_wait_ms"`    // 平均排队等待时间(毫秒)
+	AvgLatencyMs float64 `json:"avg_latency_ms"` // 平均任务耗时(毫秒)
+	DrainRate    float64 `json:"drain_rate"`     // 出队速率(任务/秒)
+}
+
+const (
+	// ewmaAlpha 指数加权平均的平滑系数
+	ewmaAlpha = 0.2
+	// minRetryAfter 建议重试的最小等待时间
+	minRetryAfter = time.Second
+	// maxRetryAfter 建议重试的最大等待时间
+	maxRetryAfter = 60 * time.Second
+)
+
 var PushQueue *Queue
 
 // InitQueue 初始化队列
@@ -37,6 +86,7 @@ func InitQueue() {
 	PushQueue = &Queue{
 		jobs:        make(chan PushJob, config.AppConfig.Queue.BufferSize),
 		workers:     config.AppConfig.Queue.WorkerCount,
+		capacity:    config.AppConfig.Queue.BufferSize,
 		ctx:         ctx,
 		cancel:      cancel,
 		pushService: pusher.NewPushService(),
@@ -48,12 +98,26 @@ func InitQueue() {
 		go PushQueue.worker(i)
 	}
 
+	// 启动指标统计协程
+	PushQueue.wg.Add(1)
+	go PushQueue.monitor()
+
 	logger.Infof("队列系统初始化完成，工作协程数: %d，缓冲区大小: %d",
 		PushQueue.workers, config.AppConfig.Queue.BufferSize)
 }
 
-// AddJob 添加任务到队列
+// AddJob 添加任务到队列，队列已满时立即返回ErrQueueFull
 func (q *Queue) AddJob(job PushJob) error {
+	return q.AddJobWithWait(context.Background(), job, 0)
+}
+
+// AddJobWithWait 添加任务到队列，队列已满时最多等待wait时间
+// ctx取消（如调用方断开连接）时停止等待并返回ctx的错误
+func (q *Queue) AddJobWithWait(ctx context.Context, job PushJob, wait time.Duration) error {
+	if job.EnqueuedAt.IsZero() {
+		job.EnqueuedAt = time.Now()
+	}
+
 	select {
 	case q.jobs <- job:
 		logger.Debugf("任务已添加到队列: %s", job.TaskID)
@@ -61,22 +125,48 @@ func (q *Queue) AddJob(job PushJob) error {
 	case <-q.ctx.Done():
 		return q.ctx.Err()
 	default:
-		logger.Warnf("队列已满，任务被拒绝: %s", job.TaskID)
-		return ErrQueueFull
 	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case q.jobs <- job:
+			logger.Debugf("任务等待后已添加到队列: %s", job.TaskID)
+			return nil
+		case <-q.ctx.Done():
+			return q.ctx.Err()
+		case <-ctx.Done():
+			logger.Debugf("调用方已取消，停止等待入队: %s", job.TaskID)
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	atomic.AddInt64(&q.rejected, 1)
+	logger.Warnf("队列已满，任务被拒绝: %s", job.TaskID)
+	return ErrQueueFull
 }
 
 // worker 工作协程
 func (q *Queue) worker(id int) {
 	defer q.wg.Done()
 
+	atomic.AddInt64(&q.aliveWorkers, 1)
+	defer atomic.AddInt64(&q.aliveWorkers, -1)
+
 	logger.Infof("工作协程 %d 启动", id)
 
 	for {
 		select {
 		case job := <-q.jobs:
 			logger.Debugf("工作协程 %d 处理任务: %s", id, job.TaskID)
+			atomic.AddInt64(&q.busyWorkers, 1)
+			startedAt := time.Now()
 			q.processJob(job)
+			atomic.AddInt64(&q.busyWorkers, -1)
+			q.recordJob(job, startedAt)
 		case <-q.ctx.Done():
 			logger.Infof("工作协程 %d 停止", id)
 			return
@@ -86,6 +176,21 @@ func (q *Queue) worker(id int) {
 
 // processJob 处理推送任务
 func (q *Queue) processJob(job PushJob) {
+	// 只沿用链路信息，不继承HTTP请求的取消，否则请求返回后推送会被中断
+	ctx := context.Background()
+	if job.TraceContext != nil {
+		ctx = context.WithoutCancel(job.TraceContext)
+	}
+
+	// 排队等待时间单独记录为一个span
+	if !job.EnqueuedAt.IsZero() {
+		_, waitSpan := tracing.Tracer().Start(ctx, "queue.wait",
+			trace.WithTimestamp(job.EnqueuedAt),
+			trace.WithAttributes(attribute.String("push.task_id", job.TaskID)),
+		)
+		waitSpan.End()
+	}
+
 	// 获取接收者配置
 	recipient, exists := config.AppConfig.GetRecipient(job.Request.RecipientAlias)
 	if !exists {
@@ -101,7 +206,7 @@ func (q *Queue) processJob(job PushJob) {
 		job.TaskID, recipient.Name, totalPushes)
 
 	// 使用推送服务执行策略
-	q.pushService.ExecuteStrategy(job.TaskID, job.Request, recipient)
+	q.pushService.ExecuteStrategy(ctx, job.TaskID, job.Request, recipient)
 }
 
 // calculateTotalPushes 计算总推送数
@@ -161,11 +266,112 @@ func (q *Queue) calculateTotalPushes(recipient config.RecipientConfig, req model
 	return total
 }
 
+// recordJob 记录任务处理指标
+func (q *Queue) recordJob(job PushJob, startedAt time.Time) {
+	atomic.AddInt64(&q.processed, 1)
+
+	if job.EnqueuedAt.IsZero() {
+		return
+	}
+
+	waitMs := float64(startedAt.Sub(job.EnqueuedAt)) / float64(time.Millisecond)
+	latencyMs := float64(time.Since(job.EnqueuedAt)) / float64(time.Millisecond)
+
+	q.statsMutex.Lock()
+	defer q.statsMutex.Unlock()
+
+	if q.avgLatencyMs == 0 {
+		q.avgWaitMs = waitMs
+		q.avgLatencyMs = latencyMs
+		return
+	}
+	q.avgWaitMs = ewmaAlpha*waitMs + (1-ewmaAlpha)*q.avgWaitMs
+	q.avgLatencyMs = ewmaAlpha*latencyMs + (1-ewmaAlpha)*q.avgLatencyMs
+}
+
+// monitor 每秒统计一次出队速率
+func (q *Queue) monitor() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			processed := atomic.LoadInt64(&q.processed)
+
+			q.statsMutex.Lock()
+			rate := float64(processed - q.lastProcessed)
+			q.lastProcessed = processed
+			q.drainRate = ewmaAlpha*rate + (1-ewmaAlpha)*q.drainRate
+			q.statsMutex.Unlock()
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats 获取队列运行指标
+func (q *Queue) Stats() QueueStats {
+	depth := len(q.jobs)
+	busy := int(atomic.LoadInt64(&q.busyWorkers))
+
+	stats := QueueStats{
+		Depth:        depth,
+		Capacity:     q.capacity,
+		Workers:      q.workers,
+		AliveWorkers: int(atomic.LoadInt64(&q.aliveWorkers)),
+		BusyWorkers:  busy,
+		Processed:    atomic.LoadInt64(&q.processed),
+		Rejected:     atomic.LoadInt64(&q.rejected),
+	}
+	if q.capacity > 0 {
+		stats.Saturation = float64(depth) / float64(q.capacity)
+	}
+	if q.workers > 0 {
+		stats.Utilization = float64(busy) / float64(q.workers)
+	}
+
+	q.statsMutex.RLock()
+	stats.AvgWaitMs = q.avgWaitMs
+	stats.AvgLatencyMs = q.avgLatencyMs
+	stats.DrainRate = q.drainRate
+	q.statsMutex.RUnlock()
+
+	return stats
+}
+
+// RetryAfter 根据当前排队深度和出队速率估算调用方的建议重试时间
+func (q *Queue) RetryAfter() time.Duration {
+	stats := q.Stats()
+
+	var seconds float64
+	switch {
+	case stats.DrainRate > 0.01:
+		seconds = float64(stats.Depth) / stats.DrainRate
+	case stats.AvgLatencyMs > 0 && stats.Workers > 0:
+		// 尚无出队速率时，按平均耗时和工作协程数估算
+		seconds = float64(stats.Depth) * stats.AvgLatencyMs / 1000 / float64(stats.Workers)
+	default:
+		return minRetryAfter
+	}
+
+	retryAfter := time.Duration(math.Ceil(seconds)) * time.Second
+	if retryAfter < minRetryAfter {
+		return minRetryAfter
+	}
+	if retryAfter > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return retryAfter
+}
+
 // Stop 停止队列
 func (q *Queue) Stop() {
 	logger.Info("正在停止队列系统...")
+	// 不关闭jobs通道，避免仍在等待入队的请求向已关闭通道发送数据
 	q.cancel()
-	close(q.jobs)
 	q.wg.Wait()
 	logger.Info("队列系统已停止")
 }
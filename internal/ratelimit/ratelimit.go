@@ -0,0 +1,275 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+	"PushServer/internal/metrics"
+)
+
+// 限流维度
+const (
+	DimensionKey       = "key"
+	DimensionIP        = "ip"
+	DimensionRecipient = "recipient"
+)
+
+const (
+	// defaultIdleTimeout 默认空闲令牌桶的清理时间
+	defaultIdleTimeout = 10 * time.Minute
+	// pruneInterval 清理空闲令牌桶的间隔
+	pruneInterval = time.Minute
+)
+
+// Limit 令牌桶参数
+type Limit struct {
+	Rate  float64 `json:"rate"`  // 每秒补充的令牌数
+	Burst int     `json:"burst"` // 桶容量
+}
+
+// unlimited 检查是否不限流
+func (l Limit) unlimited() bool {
+	return l.Rate <= 0
+}
+
+// bucket 令牌桶
+type bucket struct {
+	limit    Limit
+	tokens   float64
+	last     time.Time
+	allowed  int64
+	rejected int64
+}
+
+// refill 按经过的时间补充令牌
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = b.available(now)
+		b.last = now
+	}
+}
+
+// available 计算到now时桶内的令牌数，不修改令牌桶
+func (b *bucket) available(now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+}
+
+// Limiter 单个维度的限流器
+type Limiter struct {
+	dimension   string
+	limit       Limit
+	overrides   map[string]Limit
+	buckets     map[string]*bucket
+	idleTimeout time.Duration
+	lastPrune   time.Time
+	mutex       sync.Mutex
+}
+
+// newLimiter 创建限流器
+func newLimiter(dimension string, rule config.RateLimitRule, idleTimeout time.Duration) *Limiter {
+	return &Limiter{
+		dimension:   dimension,
+		limit:       toLimit(rule.Rate, rule.Burst),
+		overrides:   make(map[string]Limit),
+		buckets:     make(map[string]*bucket),
+		idleTimeout: idleTimeout,
+		lastPrune:   time.Now(),
+	}
+}
+
+// toLimit 转换配置，未配置桶容量时取每秒速率(至少为1)
+func toLimit(rate float64, burst int) Limit {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return Limit{Rate: rate, Burst: burst}
+}
+
+// limitFor 获取指定键的限流参数
+func (l *Limiter) limitFor(key string) Limit {
+	if limit, exists := l.overrides[key]; exists {
+		return limit
+	}
+	return l.limit
+}
+
+// Allow 消耗一个令牌，被限流时返回需要等待的时间
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	limit := l.limitFor(key)
+	if limit.unlimited() {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.allowed++
+		return true, 0
+	}
+
+	b.rejected++
+	metrics.RateLimitedTotal.WithLabelValues(l.dimension).Inc()
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// pruneLocked 清理长时间未使用的令牌桶
+func (l *Limiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > l.idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Usage 令牌桶使用情况
+type Usage struct {
+	Key        string    `json:"key"`
+	Limit      Limit     `json:"limit"`
+	Remaining  float64   `json:"remaining"`
+	Allowed    int64     `json:"allowed"`
+	Rejected   int64     `json:"rejected"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// DimensionUsage 单个维度的使用情况
+type DimensionUsage struct {
+	Limit   Limit   `json:"limit"`
+	Buckets []Usage `json:"buckets"`
+}
+
+// Usage 获取当前各令牌桶的使用情况，按被拒绝次数降序
+// 只读取令牌桶，不更新最后使用时间，查询不会让空闲的令牌桶免于清理
+func (l *Limiter) Usage() DimensionUsage {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	usages := make([]Usage, 0, len(l.buckets))
+	for key, b := range l.buckets {
+		usages = append(usages, Usage{
+			Key:        key,
+			Limit:      b.limit,
+			Remaining:  math.Floor(b.available(now)*100) / 100,
+			Allowed:    b.allowed,
+			Rejected:   b.rejected,
+			LastSeenAt: b.last,
+		})
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Rejected != usages[j].Rejected {
+			return usages[i].Rejected > usages[j].Rejected
+		}
+		return usages[i].Key < usages[j].Key
+	})
+
+	return DimensionUsage{Limit: l.limit, Buckets: usages}
+}
+
+var limiters map[string]*Limiter
+
+// InitRateLimit 根据配置初始化各维度的限流器
+func InitRateLimit() {
+	rateLimitConfig := config.AppConfig.RateLimit
+
+	idleTimeout := defaultIdleTimeout
+	if rateLimitConfig.IdleTimeout > 0 {
+		idleTimeout = time.Duration(rateLimitConfig.IdleTimeout) * time.Second
+	}
+
+	limiters = map[string]*Limiter{
+		DimensionKey:       newLimiter(DimensionKey, rateLimitConfig.PerKey, idleTimeout),
+		DimensionIP:        newLimiter(DimensionIP, rateLimitConfig.PerIP, idleTimeout),
+		DimensionRecipient: newLimiter(DimensionRecipient, rateLimitConfig.PerRecipient, idleTimeout),
+	}
+
+	for _, override := range rateLimitConfig.Overrides {
+		limiter, exists := limiters[override.Dimension]
+		if !exists {
+			logger.Errorf("限流覆盖配置的维度无效: %s，已忽略", override.Dimension)
+			continue
+		}
+		limiter.overrides[override.Key] = toLimit(override.Rate, override.Burst)
+	}
+
+	if rateLimitConfig.Enabled {
+		logger.Infof("推送接口限流已启用: 调用方=%.2f/s, IP=%.2f/s, 接收者=%.2f/s",
+			rateLimitConfig.PerKey.Rate, rateLimitConfig.PerIP.Rate, rateLimitConfig.PerRecipient.Rate)
+	}
+}
+
+// Enabled 检查是否启用限流
+func Enabled() bool {
+	return config.AppConfig.RateLimit.Enabled && limiters != nil
+}
+
+// Allow 在指定维度上消耗一个令牌，未启用限流时始终允许
+func Allow(dimension, key string) (bool, time.Duration) {
+	if !Enabled() {
+		return true, 0
+	}
+	limiter, exists := limiters[dimension]
+	if !exists {
+		return true, 0
+	}
+	return limiter.Allow(key)
+}
+
+// UsageReport 获取所有维度的使用情况
+func UsageReport() map[string]DimensionUsage {
+	report := make(map[string]DimensionUsage, len(limiters))
+	for dimension, limiter := range limiters {
+		report[dimension] = limiter.Usage()
+	}
+	return report
+}
+
+// Abort 中止被限流的请求并返回429
+func Abort(c *gin.Context, dimension, key string, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	logger.Warnf("请求被限流: %s %s, 维度: %s, 键: %s, 来源: %s", c.Request.Method, c.Request.URL.Path, dimension, key, c.ClientIP())
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(429, gin.H{
+		"code":    429,
+		"message": "请求过于频繁，请稍后重试",
+		"data": gin.H{
+			"dimension":   dimension,
+			"retry_after": retryAfter,
+		},
+	})
+}
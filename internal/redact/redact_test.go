@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"testing"
+
+	"PushServer/internal/config"
+)
+
+// setupRedaction 按测试配置初始化全局脱敏器
+func setupRedaction(t *testing.T, patterns ...string) {
+	t.Helper()
+	previousConfig := config.AppConfig
+	previousRedactor := current
+	t.Cleanup(func() {
+		config.AppConfig = previousConfig
+		current = previousRedactor
+	})
+
+	config.AppConfig = &config.Config{
+		Redaction: config.RedactionConfig{Enabled: true, MaskEmails: true, Patterns: patterns},
+		Auth: config.AuthConfig{
+			APIKeys: []config.APIKeyConfig{{Name: "ops-script"}},
+			HMAC:    config.HMACConfig{Clients: []config.HMACClientConfig{{KeyID: "ci-runner"}}},
+			ClientCerts: []config.ClientCertConfig{
+				{Name: "cron"},
+			},
+		},
+	}
+	if err := InitRedaction(); err != nil {
+		t.Fatalf("InitRedaction: %v", err)
+	}
+}
+
+func TestStringPreservesConfiguredPrincipals(t *testing.T) {
+	setupRedaction(t)
+
+	cases := map[string]string{
+		`{"actor":"api_key:ops-script","password":"hunter2"}`:    `{"actor":"api_key:ops-script","password":"***"}`,
+		"调用方 hmac:ci-runner 无权推送到接收者: ops":                       "调用方 hmac:ci-runner 无权推送到接收者: ops",
+		"caller=mtls:cron, to=alice@example.com":                 "caller=mtls:cron, to=a***@example.com",
+		"message_id=<20240101.abc@mail.example.com>":             "message_id=<20240101.abc@mail.example.com>",
+		`"In-Reply-To": "<x1@a.example.com> <x2@b.example.com>"`: `"In-Reply-To": "<x1@a.example.com> <x2@b.example.com>"`,
+	}
+	for input, want := range cases {
+		if got := String(input); got != want {
+			t.Errorf("String(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestStringMasksSecretsAfterPrincipalPrefix(t *testing.T) {
+	setupRedaction(t, `eyJ[A-Za-z0-9_\-.]+`)
+
+	cases := map[string]string{
+		// 形如认证主体标识但名称不是已配置的调用方，仍按键值对规则脱敏
+		"api_key:sk-live-4f9a8b7c6d5e":                 "api_key:***",
+		"header api_key:ops-script-sk-live-4f9a, done": "header api_key:***, done",
+		`{"note":"api_key:sk-live-4f9a8b7c6d5e"}`:      `{"note":"api_key:***"}`,
+		// 自定义正则同样作用于前缀后的内容
+		"Authorization jwt:eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0.c2ln": "Authorization jwt:***",
+		"hmac:eyJhbGciOiJIUzI1NiJ9.e30.c2ln":                          "hmac:***",
+	}
+	for input, want := range cases {
+		if got := String(input); got != want {
+			t.Errorf("String(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestStringWithoutConfiguredPrincipals(t *testing.T) {
+	setupRedaction(t)
+	config.AppConfig.Auth = config.AuthConfig{}
+	if err := InitRedaction(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := String("actor=api_key:ops-script"); got != "actor=api_key:***" {
+		t.Errorf("unconfigured principal = %q, want masked", got)
+	}
+}
@@ -1,7 +1,10 @@
 package router
 
 import (
+	"PushServer/internal/auth"
+	"PushServer/internal/config"
 	"PushServer/internal/handler"
+	"PushServer/internal/logger"
 	"PushServer/internal/middleware"
 	"github.com/gin-gonic/gin"
 )
@@ -9,41 +12,79 @@ import (
 // SetupRouter 设置路由
 func SetupRouter() *gin.Engine {
 	r := gin.New()
+	serverConfig := config.AppConfig.Server
+
+	// 仅信任配置的代理转发的X-Forwarded-For，避免ClientIP被伪造
+	if err := r.SetTrustedProxies(serverConfig.TrustedProxies); err != nil {
+		logger.Errorf("可信代理配置无效: %v，将不信任任何代理", err)
+		r.SetTrustedProxies(nil)
+	}
 
 	// 添加中间件
 	r.Use(middleware.Logger())
 	r.Use(middleware.Recovery())
-	r.Use(middleware.CORS())
+	r.Use(middleware.CORS(serverConfig.CORS))
+
+	authenticate := middleware.Authenticate()
+	read := middleware.RequirePermission(auth.PermissionRead)
 
-	// 健康检查
+	// 健康检查，详细检查包含账户和主机信息，需要read权限
 	r.GET("/health", handler.HealthCheck)
+	r.GET("/health/details", middleware.Redact(), authenticate, read, handler.HealthDetails)
+	r.GET("/ready", handler.Ready)
 
-	// API路由组
-	api := r.Group("/api/v1")
+	// Prometheus指标
+	r.GET("/metrics", handler.Metrics())
+
+	// API路由组，IP访问控制先于认证执行
+	api := r.Group("/api/v1", middleware.Redact())
 	{
+		admin := middleware.RequirePermission(auth.PermissionAdmin)
+		ipFilter := serverConfig.IPFilter
+
 		// 消息推送接口
-		api.POST("/push", handler.PushMessage)
+		push := api.Group("", middleware.IPFilter("push", ipFilter.Push), authenticate)
+		push.POST("/push", middleware.RequirePermission(auth.PermissionPush), middleware.RateLimit(), handler.PushMessage)
 
-		// 任务状态查询接口
-		api.GET("/task/:id", handler.GetTaskStatus)
+		common := api.Group("", authenticate)
+		{
+			// 任务状态查询接口
+			common.GET("/task/:id", middleware.RequirePermission(auth.PermissionPush, auth.PermissionRead), handler.GetTaskStatus)
+
+			// 队列指标接口
+			common.GET("/queue/statistics", read, handler.GetQueueStatistics)
+
+			// 投递统计接口
+			common.GET("/statistics", read, handler.GetDeliveryStatistics)
+
+			// 限流使用情况接口
+			common.GET("/rate-limit/usage", admin, handler.GetRateLimitUsage)
+
+			// 审计日志接口
+			common.GET("/audit", admin, handler.GetAuditEvents)
+			common.GET("/audit/verify", admin, handler.VerifyAuditLog)
+		}
 
 		// 系统通知接口
-		notifications := api.Group("/notifications")
+		notifications := api.Group("/notifications", middleware.IPFilter("notifications", ipFilter.Notifications), authenticate)
 		{
-			notifications.GET("", handler.GetSystemNotifications)               // 获取通知列表
-			notifications.GET("/:id", handler.GetSystemNotification)            // 获取单个通知
-			notifications.PUT("/:id/read", handler.MarkNotificationAsRead)      // 标记为已读
-			notifications.PUT("/read-all", handler.MarkAllNotificationsAsRead)  // 标记所有为已读
-			notifications.DELETE("/:id", handler.DeleteSystemNotification)      // 删除通知
-			notifications.DELETE("", handler.ClearAllNotifications)             // 清空所有通知
-			notifications.GET("/statistics", handler.GetNotificationStatistics) // 获取统计信息
+			notifications.GET("", read, handler.GetSystemNotifications)               // 获取通知列表
+			notifications.GET("/:id", read, handler.GetSystemNotification)            // 获取单个通知
+			notifications.PUT("/:id/read", admin, handler.MarkNotificationAsRead)     // 标记为已读
+			notifications.PUT("/read-all", admin, handler.MarkAllNotificationsAsRead) // 标记所有为已读
+			notifications.DELETE("/:id", admin, handler.DeleteSystemNotification)     // 删除通知
+			notifications.DELETE("", admin, handler.ClearAllNotifications)            // 清空所有通知
+			notifications.GET("/statistics", read, handler.GetNotificationStatistics) // 获取统计信息
 		}
 
 		// SMTP中继接口
-		smtpRelay := api.Group("/smtp-relay")
+		smtpRelay := api.Group("/smtp-relay", middleware.IPFilter("smtp_relay", ipFilter.SMTPRelay), authenticate)
 		{
-			smtpRelay.GET("/status", handler.GetSMTPRelayStatus)         // 获取中继状态
-			smtpRelay.GET("/statistics", handler.GetSMTPRelayStatistics) // 获取中继统计
+			smtpRelay.GET("/status", read, handler.GetSMTPRelayStatus)                    // 获取中继状态
+			smtpRelay.GET("/statistics", read, handler.GetSMTPRelayStatistics)            // 获取中继统计
+			smtpRelay.GET("/queue", read, handler.GetSMTPRelayQueue)                      // 获取队列中的邮件
+			smtpRelay.POST("/queue/:id/retry", admin, handler.RetrySMTPRelayQueueMessage) // 立即重试
+			smtpRelay.DELETE("/queue/:id", admin, handler.DeleteSMTPRelayQueueMessage)    // 删除队列邮件
 		}
 	}
 
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,7 +16,8 @@ import (
 )
 
 type Server struct {
-	httpServer *http.Server
+	httpServer  *http.Server
+	httpsServer *http.Server
 }
 
 // NewServer 创建新的服务器实例
@@ -30,20 +32,50 @@ func (s *Server) Start() error {
 
 	// 创建路由
 	r := router.SetupRouter()
+	tlsConfig := config.AppConfig.Server.TLS
 
-	// 创建HTTP服务器
-	s.httpServer = &http.Server{
-		Addr:    config.AppConfig.GetServerAddr(),
-		Handler: r,
+	// 创建HTTPS服务器
+	if tlsConfig.Enabled {
+		serverTLSConfig, err := buildTLSConfig(tlsConfig)
+		if err != nil {
+			return fmt.Errorf("HTTPS配置无效: %w", err)
+		}
+
+		port := tlsConfig.Port
+		if port == 0 {
+			port = 8443
+		}
+		addr := fmt.Sprintf("%s:%d", config.AppConfig.Server.Host, port)
+		s.httpsServer = &http.Server{
+			Addr:      addr,
+			Handler:   r,
+			TLSConfig: serverTLSConfig,
+		}
+
+		go func() {
+			logger.Infof("HTTPS服务器启动在 %s, 客户端证书校验: %s", addr, tlsConfig.ClientAuth)
+			// 证书由TLSConfig.GetCertificate提供
+			if err := s.httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("HTTPS服务器启动失败: %v", err)
+			}
+		}()
 	}
 
-	// 启动服务器的goroutine
-	go func() {
-		logger.Infof("服务器启动在 %s", config.AppConfig.GetServerAddr())
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Errorf("服务器启动失败: %v", err)
+	// 创建HTTP服务器，启用HTTPS时仅在serve_http为true时同时提供
+	if !tlsConfig.Enabled || tlsConfig.ServeHTTP {
+		s.httpServer = &http.Server{
+			Addr:    config.AppConfig.GetServerAddr(),
+			Handler: r,
 		}
-	}()
+
+		// 启动服务器的goroutine
+		go func() {
+			logger.Infof("服务器启动在 %s", config.AppConfig.GetServerAddr())
+			if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("服务器启动失败: %v", err)
+			}
+		}()
+	}
 
 	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
@@ -52,11 +84,7 @@ func (s *Server) Start() error {
 
 	logger.Info("正在关闭服务器...")
 
-	// 优雅关闭服务器，等待5秒钟完成现有请求
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := s.httpServer.Shutdown(ctx); err != nil {
+	if err := s.Stop(); err != nil {
 		logger.Errorf("服务器强制关闭: %v", err)
 		return err
 	}
@@ -65,12 +93,19 @@ func (s *Server) Start() error {
 	return nil
 }
 
-// Stop 停止服务器
+// Stop 停止服务器，等待5秒钟完成现有请求
 func (s *Server) Stop() error {
-	if s.httpServer != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		return s.httpServer.Shutdown(ctx)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var firstErr error
+	for _, srv := range []*http.Server{s.httpServer, s.httpsServer} {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return nil
-}
\ No newline at end of file
+	return firstErr
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"PushServer/internal/config"
+	"PushServer/internal/tlsutil"
+)
+
+// buildTLSConfig 根据配置创建HTTPS的TLS配置
+func buildTLSConfig(tlsConfig config.HTTPTLSConfig) (*tls.Config, error) {
+	interval := time.Duration(tlsConfig.ReloadInterval) * time.Second
+	reloader, err := tlsutil.NewCertReloader(tlsConfig.CertFile, tlsConfig.KeyFile, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &tls.Config{
+		MinVersion:     tlsutil.ParseMinVersion(tlsConfig.MinVersion),
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch strings.ToLower(tlsConfig.ClientAuth) {
+	case "", "none":
+		result.ClientAuth = tls.NoClientCert
+	case "optional":
+		result.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		result.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("无效的client_auth: %s", tlsConfig.ClientAuth)
+	}
+
+	if result.ClientAuth != tls.NoClientCert {
+		if tlsConfig.ClientCAFile == "" {
+			return nil, fmt.Errorf("启用客户端证书校验时必须配置client_ca_file")
+		}
+		caData, err := os.ReadFile(tlsConfig.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端CA文件失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("客户端CA文件中没有有效的证书")
+		}
+		result.ClientCAs = pool
+	}
+
+	return result, nil
+}
@@ -0,0 +1,215 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"PushServer/internal/config"
+)
+
+// SASL认证机制
+const (
+	mechanismPlain   = "PLAIN"
+	mechanismLogin   = "LOGIN"
+	mechanismCRAMMD5 = "CRAM-MD5"
+)
+
+// dummyPassword 用户不存在时参与比较的密码，使耗时与用户存在时一致
+const dummyPassword = "push-server-dummy-password"
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// dummyHash 首次认证时才生成比较用的bcrypt哈希，避免拖慢不使用中继的子命令
+func dummyHash() []byte {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte(dummyPassword), bcrypt.DefaultCost)
+	})
+	return dummyPasswordHash
+}
+
+// HashPassword 生成中继用户的bcrypt密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// findUser 按用户名查找中继用户
+func (s *SMTPServer) findUser(username string) (config.SMTPRelayUserConfig, bool) {
+	for _, user := range s.config.Users {
+		if user.Username == username {
+			return user, true
+		}
+	}
+	return config.SMTPRelayUserConfig{}, false
+}
+
+// verifyPassword 校验用户名密码，优先使用bcrypt哈希
+func (s *SMTPServer) verifyPassword(username, password string) bool {
+	user, found := s.findUser(username)
+	if !found || username == "" {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+	if user.PasswordHash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+	}
+	if user.Password != "" {
+		return subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1
+	}
+	return false
+}
+
+// cramMD5Enabled 是否有用户配置了明文密码，CRAM-MD5需要明文密码计算HMAC
+func (s *SMTPServer) cramMD5Enabled() bool {
+	for _, user := range s.config.Users {
+		if user.Password != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// authMechanisms 返回EHLO中公布的认证机制
+func (s *SMTPServer) authMechanisms() string {
+	mechanisms := []string{mechanismPlain, mechanismLogin}
+	if s.cramMD5Enabled() {
+		mechanisms = append(mechanisms, mechanismCRAMMD5)
+	}
+	return strings.Join(mechanisms, " ")
+}
+
+var (
+	// errAuthCancelled 客户端以"*"取消认证
+	errAuthCancelled = errors.New("authentication cancelled")
+	// errAuthMalformed 认证数据无法解码或格式错误
+	errAuthMalformed = errors.New("malformed authentication response")
+)
+
+// readAuthResponse 发送334质询并读取客户端的Base64响应
+func (s *SMTPSession) readAuthResponse(challenge string) ([]byte, error) {
+	if err := s.writer.PrintfLine("334 %s", challenge); err != nil {
+		return nil, err
+	}
+	line, err := s.readLine(authLineLength)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(line) == "*" {
+		return nil, errAuthCancelled
+	}
+	return decodeAuthData(line)
+}
+
+// decodeAuthData 解码Base64认证数据，"="表示空的初始响应
+func decodeAuthData(data string) ([]byte, error) {
+	data = strings.TrimSpace(data)
+	if data == "=" {
+		return []byte{}, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errAuthMalformed
+	}
+	return decoded, nil
+}
+
+// authPlain 处理PLAIN认证(RFC 4616)，支持初始响应和334续行两种形式
+func (s *SMTPSession) authPlain(initial string) (string, bool, error) {
+	var response []byte
+	var err error
+	if initial != "" {
+		response, err = decodeAuthData(initial)
+	} else {
+		response, err = s.readAuthResponse("")
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	// 格式: authzid \0 authcid \0 passwd
+	fields := bytes.Split(response, []byte{0})
+	if len(fields) != 3 {
+		return "", false, errAuthMalformed
+	}
+	authzid, username, password := string(fields[0]), string(fields[1]), string(fields[2])
+
+	// 不支持代理其他用户身份
+	if authzid != "" && authzid != username {
+		return username, false, nil
+	}
+	return username, s.server.verifyPassword(username, password), nil
+}
+
+// authLogin 处理LOGIN认证，支持在AUTH命令中直接携带用户名
+func (s *SMTPSession) authLogin(initial string) (string, bool, error) {
+	var usernameBytes []byte
+	var err error
+	if initial != "" {
+		usernameBytes, err = decodeAuthData(initial)
+	} else {
+		usernameBytes, err = s.readAuthResponse("VXNlcm5hbWU6") // "Username:"
+	}
+	if err != nil {
+		return "", false, err
+	}
+	username := string(usernameBytes)
+
+	password, err := s.readAuthResponse("UGFzc3dvcmQ6") // "Password:"
+	if err != nil {
+		return username, false, err
+	}
+	return username, s.server.verifyPassword(username, string(password)), nil
+}
+
+// authCRAMMD5 处理CRAM-MD5认证(RFC 2195)，仅配置了明文密码的用户可用
+func (s *SMTPSession) authCRAMMD5() (string, bool, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", false, err
+	}
+	challenge := fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(nonce), time.Now().Unix(), s.server.config.Server.Host)
+
+	response, err := s.readAuthResponse(base64.StdEncoding.EncodeToString([]byte(challenge)))
+	if err != nil {
+		return "", false, err
+	}
+
+	// 格式: username SP hex(hmac-md5(password, challenge))
+	separator := bytes.LastIndexByte(response, ' ')
+	if separator <= 0 {
+		return "", false, errAuthMalformed
+	}
+	username := string(response[:separator])
+	digest := response[separator+1:]
+
+	// 用户不存在或未配置明文密码时同样计算一次HMAC，使耗时一致
+	user, found := s.server.findUser(username)
+	usable := found && user.Password != ""
+	secret := user.Password
+	if !usable {
+		secret = dummyPassword
+	}
+	mac := hmac.New(md5.New, []byte(secret))
+	mac.Write([]byte(challenge))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	matched := hmac.Equal([]byte(expected), bytes.ToLower(digest))
+	return username, usable && matched, nil
+}
@@ -0,0 +1,325 @@
+package smtp
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+// testClient 通过net.Pipe与SMTPServer会话交互的客户端
+type testClient struct {
+	t    *testing.T
+	conn *textproto.Conn
+}
+
+// newTestServer 创建只用于认证测试的SMTPServer
+func newTestServer(t *testing.T, users ...config.SMTPRelayUserConfig) *SMTPServer {
+	t.Helper()
+	logger.Logger = logrus.New()
+	logger.Logger.SetOutput(io.Discard)
+
+	server := &SMTPServer{
+		config: &config.SMTPRelayConfig{
+			Enabled: true,
+			Server:  config.SMTPServerConfig{Host: "relay.test"},
+			Users:   users,
+		},
+		conns: make(map[net.Conn]struct{}),
+	}
+	server.running.Store(true)
+	return server
+}
+
+// dial 建立一个会话并读取欢迎消息
+func dial(t *testing.T, server *SMTPServer) *testClient {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	server.sessionWG.Add(1)
+	go server.handleConnection(serverConn, false)
+	t.Cleanup(func() {
+		clientConn.Close()
+		server.sessionWG.Wait()
+	})
+
+	client := &testClient{t: t, conn: textproto.NewConn(clientConn)}
+	client.expect(220)
+	return client
+}
+
+// send 发送一行并返回响应码和文本
+func (c *testClient) send(format string, args ...interface{}) (int, string) {
+	c.t.Helper()
+	if err := c.conn.PrintfLine(format, args...); err != nil {
+		c.t.Fatalf("write %q: %v", format, err)
+	}
+	code, message, err := c.conn.ReadResponse(0)
+	if err != nil {
+		c.t.Fatalf("read response to %q: %v", format, err)
+	}
+	return code, message
+}
+
+// expect 读取一条响应并检查响应码
+func (c *testClient) expect(want int) string {
+	c.t.Helper()
+	code, message, err := c.conn.ReadResponse(0)
+	if err != nil {
+		c.t.Fatalf("read response: %v", err)
+	}
+	if code != want {
+		c.t.Fatalf("response = %d %s, want %d", code, message, want)
+	}
+	return message
+}
+
+// sendExpect 发送一行并检查响应码
+func (c *testClient) sendExpect(want int, format string, args ...interface{}) string {
+	c.t.Helper()
+	code, message := c.send(format, args...)
+	if code != want {
+		c.t.Fatalf("%s: response = %d %s, want %d", strings.Fields(format)[0], code, message, want)
+	}
+	return message
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// hashUser 使用最低成本的bcrypt哈希创建用户，加快测试
+func hashUser(t *testing.T, username, password string) config.SMTPRelayUserConfig {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.SMTPRelayUserConfig{Username: username, PasswordHash: string(hash)}
+}
+
+func TestEHLOAdvertisesCRAMMD5OnlyWithPlaintextUser(t *testing.T) {
+	withHashOnly := newTestServer(t, hashUser(t, "alice", "secret1"))
+	message := dial(t, withHashOnly).sendExpect(250, "EHLO client.test")
+	if !strings.Contains(message, "AUTH PLAIN LOGIN") || strings.Contains(message, "CRAM-MD5") {
+		t.Errorf("EHLO without plaintext users = %q", message)
+	}
+
+	withPlaintext := newTestServer(t, hashUser(t, "alice", "secret1"), config.SMTPRelayUserConfig{Username: "bob", Password: "secret2"})
+	message = dial(t, withPlaintext).sendExpect(250, "EHLO client.test")
+	if !strings.Contains(message, "AUTH PLAIN LOGIN CRAM-MD5") {
+		t.Errorf("EHLO with plaintext user = %q", message)
+	}
+}
+
+func TestAuthPlain(t *testing.T) {
+	server := newTestServer(t, hashUser(t, "alice", "secret1"), config.SMTPRelayUserConfig{Username: "bob", Password: "secret2"})
+
+	tests := []struct {
+		name     string
+		exchange func(c *testClient) int
+		want     int
+	}{
+		{"initial response", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("\x00alice\x00secret1"))
+			return code
+		}, 235},
+		{"continuation", func(c *testClient) int {
+			if message := c.sendExpect(334, "AUTH PLAIN"); message != "" {
+				t.Errorf("PLAIN challenge = %q, want empty", message)
+			}
+			code, _ := c.send("%s", b64("\x00alice\x00secret1"))
+			return code
+		}, 235},
+		{"plaintext password user", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("\x00bob\x00secret2"))
+			return code
+		}, 235},
+		{"matching authzid", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("alice\x00alice\x00secret1"))
+			return code
+		}, 235},
+		{"wrong password", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("\x00alice\x00wrong"))
+			return code
+		}, 535},
+		{"unknown user", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("\x00mallory\x00secret1"))
+			return code
+		}, 535},
+		{"impersonation via authzid", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("bob\x00alice\x00secret1"))
+			return code
+		}, 535},
+		{"missing fields", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN %s", b64("alice\x00secret1"))
+			return code
+		}, 501},
+		{"invalid base64", func(c *testClient) int {
+			code, _ := c.send("AUTH PLAIN not-base64!")
+			return code
+		}, 501},
+		{"cancelled", func(c *testClient) int {
+			c.sendExpect(334, "AUTH PLAIN")
+			code, _ := c.send("*")
+			return code
+		}, 501},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial(t, server)
+			client.sendExpect(250, "EHLO client.test")
+			if got := tt.exchange(client); got != tt.want {
+				t.Errorf("response = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthLogin(t *testing.T) {
+	server := newTestServer(t, hashUser(t, "alice", "secret1"))
+
+	t.Run("prompts", func(t *testing.T) {
+		client := dial(t, server)
+		client.sendExpect(250, "EHLO client.test")
+		if message := client.sendExpect(334, "AUTH LOGIN"); message != b64("Username:") {
+			t.Errorf("username prompt = %q", message)
+		}
+		if message := client.sendExpect(334, "%s", b64("alice")); message != b64("Password:") {
+			t.Errorf("password prompt = %q", message)
+		}
+		client.sendExpect(235, "%s", b64("secret1"))
+	})
+
+	t.Run("initial username", func(t *testing.T) {
+		client := dial(t, server)
+		client.sendExpect(250, "EHLO client.test")
+		client.sendExpect(334, "AUTH LOGIN %s", b64("alice"))
+		client.sendExpect(235, "%s", b64("secret1"))
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		client := dial(t, server)
+		client.sendExpect(250, "EHLO client.test")
+		client.sendExpect(334, "AUTH LOGIN %s", b64("alice"))
+		client.sendExpect(535, "%s", b64("wrong"))
+
+		// 认证失败后会话仍可重新认证
+		client.sendExpect(334, "AUTH LOGIN %s", b64("alice"))
+		client.sendExpect(235, "%s", b64("secret1"))
+		client.sendExpect(503, "AUTH LOGIN %s", b64("alice"))
+	})
+
+	t.Run("cancelled at password", func(t *testing.T) {
+		client := dial(t, server)
+		client.sendExpect(250, "EHLO client.test")
+		client.sendExpect(334, "AUTH LOGIN %s", b64("alice"))
+		client.sendExpect(501, "*")
+	})
+}
+
+// cramResponse 按RFC 2195计算CRAM-MD5响应
+func cramResponse(t *testing.T, challenge, username, password string) string {
+	t.Helper()
+	decoded, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil {
+		t.Fatalf("challenge %q: %v", challenge, err)
+	}
+	mac := hmac.New(md5.New, []byte(password))
+	mac.Write(decoded)
+	return b64(fmt.Sprintf("%s %s", username, hex.EncodeToString(mac.Sum(nil))))
+}
+
+func TestAuthCRAMMD5(t *testing.T) {
+	server := newTestServer(t, hashUser(t, "alice", "secret1"), config.SMTPRelayUserConfig{Username: "bob", Password: "secret2"})
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"plaintext user", "bob", "secret2", 235},
+		{"wrong password", "bob", "wrong", 535},
+		// 只有bcrypt哈希的用户无法使用CRAM-MD5
+		{"hash-only user", "alice", "secret1", 535},
+		{"unknown user", "mallory", "secret2", 535},
+		// 不存在的用户即使用占位密码计算响应也不能通过
+		{"dummy password", "mallory", dummyPassword, 535},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial(t, server)
+			client.sendExpect(250, "EHLO client.test")
+			challenge := client.sendExpect(334, "AUTH CRAM-MD5")
+			decoded, _ := base64.StdEncoding.DecodeString(challenge)
+			if !strings.HasPrefix(string(decoded), "<") || !strings.HasSuffix(string(decoded), "@relay.test>") {
+				t.Errorf("challenge = %q", decoded)
+			}
+			client.sendExpect(tt.want, "%s", cramResponse(t, challenge, tt.username, tt.password))
+		})
+	}
+
+	t.Run("not offered without plaintext users", func(t *testing.T) {
+		client := dial(t, newTestServer(t, hashUser(t, "alice", "secret1")))
+		client.sendExpect(250, "EHLO client.test")
+		client.sendExpect(504, "AUTH CRAM-MD5")
+	})
+}
+
+func TestAuthRequiresTLSWhenConfigured(t *testing.T) {
+	server := newTestServer(t, hashUser(t, "alice", "secret1"))
+	server.config.TLS.RequireTLS = true
+
+	client := dial(t, server)
+	client.sendExpect(250, "EHLO client.test")
+	client.sendExpect(530, "AUTH PLAIN %s", b64("\x00alice\x00secret1"))
+}
+
+func TestVerifyPasswordUsesLazyDummyHashForUnknownUsers(t *testing.T) {
+	dummyPasswordHash = nil
+	dummyPasswordHashOnce = sync.Once{}
+
+	server := newTestServer(t, hashUser(t, "alice", "secret1"))
+	if dummyPasswordHash != nil {
+		t.Fatal("dummy hash computed before the first authentication")
+	}
+
+	if server.verifyPassword("mallory", "secret1") {
+		t.Fatal("unknown user accepted")
+	}
+	if server.verifyPassword("", "") {
+		t.Fatal("empty username accepted")
+	}
+	// 占位哈希的成本与真实密码哈希一致，不存在的用户同样要经过一次完整的bcrypt比较
+	cost, err := bcrypt.Cost(dummyPasswordHash)
+	if err != nil {
+		t.Fatalf("dummy hash not generated: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("dummy hash cost = %d, want %d", cost, bcrypt.DefaultCost)
+	}
+	if bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(dummyPassword)) != nil {
+		t.Error("dummy hash does not match dummyPassword")
+	}
+
+	// 占位密码不能作为不存在用户的有效密码
+	if server.verifyPassword("mallory", dummyPassword) {
+		t.Error("dummy password accepted for unknown user")
+	}
+	if !server.verifyPassword("alice", "secret1") || server.verifyPassword("alice", "wrong") {
+		t.Error("verifyPassword for configured user")
+	}
+}
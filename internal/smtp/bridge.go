@@ -0,0 +1,117 @@
+package smtp
+
+import (
+	"fmt"
+	"strings"
+
+	"PushServer/internal/config"
+	"PushServer/internal/model"
+)
+
+// 桥接邮件中可覆盖推送参数的邮件头
+const (
+	headerPushType     = "X-Push-Type"
+	headerPushStrategy = "X-Push-Strategy"
+	headerPushStyle    = "X-Push-Style"
+	headerPushPlatform = "X-Push-Platform"
+)
+
+// SubmitPush 提交桥接邮件转换出的推送请求并返回任务ID
+// 由main注入，避免smtp包依赖队列和任务管理
+var SubmitPush func(req model.PushRequest, caller string) (string, error)
+
+// smtpError 带SMTP响应码的错误，handleData按响应码回复客户端
+type smtpError struct {
+	code     int
+	enhanced string
+	message  string
+}
+
+func (e *smtpError) Error() string {
+	return fmt.Sprintf("%d %s %s", e.code, e.enhanced, e.message)
+}
+
+// bridgeEnabled 是否启用邮件转IM桥接
+func (s *SMTPServer) bridgeEnabled() bool {
+	return s.config.Bridge.Enabled && s.config.Bridge.Domain != "" && SubmitPush != nil
+}
+
+// bridgeAlias 返回发往桥接域名的收件人对应的接收者别名
+func (s *SMTPServer) bridgeAlias(address string) (string, bool) {
+	if !s.bridgeEnabled() {
+		return "", false
+	}
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || !strings.EqualFold(address[at+1:], s.config.Bridge.Domain) {
+		return "", false
+	}
+	return address[:at], true
+}
+
+// splitBridgeRecipients 将信封收件人分为桥接接收者别名和需要转发的邮件地址
+func (s *SMTPServer) splitBridgeRecipients(recipients []string) ([]string, []string) {
+	var aliases, mailRecipients []string
+	for _, recipient := range recipients {
+		if alias, ok := s.bridgeAlias(recipient); ok {
+			aliases = append(aliases, alias)
+		} else {
+			mailRecipients = append(mailRecipients, recipient)
+		}
+	}
+	return aliases, mailRecipients
+}
+
+// buildBridgeRequest 将邮件转换为推送请求：主题作为标题，纯文本正文作为内容
+func (s *SMTPServer) buildBridgeRequest(alias string, msg EmailMessage) (model.PushRequest, error) {
+	bridgeConfig := s.config.Bridge
+	req := model.PushRequest{
+		RecipientAlias: alias,
+		Type:           headerOrDefault(msg, headerPushType, bridgeConfig.DefaultType),
+		Strategy:       headerOrDefault(msg, headerPushStrategy, bridgeConfig.DefaultStrategy),
+		Style:          headerOrDefault(msg, headerPushStyle, bridgeConfig.DefaultStyle),
+		Platform:       headerOrDefault(msg, headerPushPlatform, ""),
+		Content: model.MessageContent{
+			Title: msg.Subject,
+			Msg:   textBody(msg),
+		},
+	}
+	if req.Content.Msg == "" {
+		req.Content.Msg = req.Content.Title
+	}
+
+	req.SetDefaults()
+	if err := req.Validate(); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// headerOrDefault 读取邮件头，未设置时使用默认值
+func headerOrDefault(msg EmailMessage, name, defaultValue string) string {
+	if msg.Header != nil {
+		if value := strings.TrimSpace(msg.Header.Get(name)); value != "" {
+			return strings.ToLower(value)
+		}
+	}
+	return defaultValue
+}
+
+// allowsBridgeAlias 检查中继用户是否可以推送到接收者别名
+// 配置了allowed_aliases时按别名检查，否则桥接地址同样受allowed_recipient_domains限制
+func allowsBridgeAlias(user config.SMTPRelayUserConfig, alias, address string) bool {
+	if len(user.AllowedAliases) == 0 {
+		return allowsRecipient(user, address)
+	}
+	for _, allowed := range user.AllowedAliases {
+		if allowed == "*" || allowed == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// validBridgeRecipient 检查桥接接收者别名是否已配置
+func validBridgeRecipient(alias string) bool {
+	_, exists := config.AppConfig.GetRecipient(alias)
+	return exists
+}
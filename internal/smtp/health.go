@@ -0,0 +1,265 @@
+package smtp
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"PushServer/internal/config"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultAccountCooldown  = 300 * time.Second
+)
+
+// 账户状态
+const (
+	AccountStatusHealthy   = "healthy"
+	AccountStatusCooldown  = "cooldown"
+	AccountStatusExhausted = "quota_exhausted"
+	AccountStatusDisabled  = "disabled"
+)
+
+// accountFailure 账户级别的失败（连接、STARTTLS或认证失败），连续出现时账户进入冷却
+// 收件人被拒绝等与具体邮件相关的失败不计入
+type accountFailure struct {
+	err error
+}
+
+func (e *accountFailure) Error() string {
+	return e.err.Error()
+}
+
+func (e *accountFailure) Unwrap() error {
+	return e.err
+}
+
+// accountHealth 单个账户的发送统计，重启后清零
+type accountHealth struct {
+	successes     int64
+	failures      int64
+	attempts      int64
+	totalLatency  time.Duration
+	lastLatency   time.Duration
+	consecutive   int
+	day           string
+	sentToday     int // 当日已投递的收件人数
+	reserved      int // 正在发送的邮件预占的收件人数
+	lastError     string
+	lastErrorAt   time.Time
+	lastSuccessAt time.Time
+	disabledUntil time.Time
+}
+
+// healthTracker 按账户名记录发送结果，所有RelayService实例共享
+type healthTracker struct {
+	accounts map[string]*accountHealth
+	mutex    sync.Mutex
+}
+
+// accountHealthTracker 账户健康状态
+var accountHealthTracker = &healthTracker{accounts: make(map[string]*accountHealth)}
+
+// get 获取账户的统计项，跨天时清空当日发送数和预占数，调用方需持有锁
+func (t *healthTracker) get(name string) *accountHealth {
+	health, exists := t.accounts[name]
+	if !exists {
+		health = &accountHealth{}
+		t.accounts[name] = health
+	}
+	today := time.Now().Format("2006-01-02")
+	if health.day != today {
+		health.day = today
+		health.sentToday = 0
+		health.reserved = 0
+	}
+	return health
+}
+
+// status 返回账户当前状态，调用方需持有锁
+func (t *healthTracker) status(account config.SMTPAccountConfig, now time.Time) string {
+	if !account.Enabled {
+		return AccountStatusDisabled
+	}
+	health := t.get(account.Name)
+	if now.Before(health.disabledUntil) {
+		return AccountStatusCooldown
+	}
+	if account.DailyLimit > 0 && health.sentToday+health.reserved >= account.DailyLimit {
+		return AccountStatusExhausted
+	}
+	return AccountStatusHealthy
+}
+
+// usable 过滤掉处于冷却或已达每日上限的账户
+func (t *healthTracker) usable(accounts []config.SMTPAccountConfig) []config.SMTPAccountConfig {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	var usable []config.SMTPAccountConfig
+	for _, account := range accounts {
+		if t.status(account, now) == AccountStatusHealthy {
+			usable = append(usable, account)
+		}
+	}
+	return usable
+}
+
+// reserve 发送前为邮件的收件人预占账户的每日额度，账户不可用或剩余额度不足时返回false
+// 检查和预占在同一把锁内完成，并发会话不会超过daily_limit；返回的日期用于之后结算预占
+func (t *healthTracker) reserve(account config.SMTPAccountConfig, recipients int) (string, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status(account, time.Now()) != AccountStatusHealthy {
+		return "", false
+	}
+	health := t.get(account.Name)
+	if account.DailyLimit > 0 && health.sentToday+health.reserved+recipients > account.DailyLimit {
+		return "", false
+	}
+	health.reserved += recipients
+	return health.day, true
+}
+
+// settle 结算reserve预占的额度，发送成功时计入当日发送数，失败时释放
+// 预占后已跨天的额度随当日统计一起清零，不再结算
+func (h *accountHealth) settle(day string, recipients int, sent bool) {
+	if h.day != day {
+		return
+	}
+	h.reserved -= recipients
+	if h.reserved < 0 {
+		h.reserved = 0
+	}
+	if sent {
+		h.sentToday += recipients
+	}
+}
+
+// recordSuccess 记录一次成功发送，预占的收件人额度计入当日发送数
+func (t *healthTracker) recordSuccess(name, day string, recipients int, latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	health := t.get(name)
+	health.successes++
+	health.attempts++
+	health.totalLatency += latency
+	health.lastLatency = latency
+	health.consecutive = 0
+	health.lastSuccessAt = time.Now()
+	health.settle(day, recipients, true)
+}
+
+// recordFailure 记录一次失败发送并释放预占的额度，账户级别失败连续达到阈值时进入冷却
+// 冷却结束后连续失败数不清零，再失败一次会立即重新进入冷却
+func (t *healthTracker) recordFailure(name, day string, recipients int, latency time.Duration, err error, threshold int, cooldown time.Duration) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	health := t.get(name)
+	health.settle(day, recipients, false)
+	health.failures++
+	health.attempts++
+	health.totalLatency += latency
+	health.lastLatency = latency
+	health.lastError = err.Error()
+	health.lastErrorAt = time.Now()
+
+	var failure *accountFailure
+	if !errors.As(err, &failure) {
+		return false
+	}
+	health.consecutive++
+	if health.consecutive < threshold {
+		return false
+	}
+	health.disabledUntil = time.Now().Add(cooldown)
+	return true
+}
+
+// snapshot 返回账户的健康统计
+func (t *healthTracker) snapshot(account config.SMTPAccountConfig) map[string]interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	status := t.status(account, now)
+	health := t.get(account.Name)
+
+	stats := map[string]interface{}{
+		"status":               status,
+		"weight":               accountWeight(account),
+		"daily_limit":          account.DailyLimit,
+		"sent_today":           health.sentToday,
+		"sent_count":           health.successes,
+		"failed_count":         health.failures,
+		"consecutive_failures": health.consecutive,
+		"avg_latency_ms":       int64(0),
+		"last_latency_ms":      health.lastLatency.Milliseconds(),
+	}
+	if health.attempts > 0 {
+		stats["avg_latency_ms"] = (health.totalLatency / time.Duration(health.attempts)).Milliseconds()
+	}
+	if health.lastError != "" {
+		stats["last_error"] = health.lastError
+		stats["last_error_at"] = health.lastErrorAt
+	}
+	if !health.lastSuccessAt.IsZero() {
+		stats["last_success_at"] = health.lastSuccessAt
+	}
+	if status == AccountStatusCooldown {
+		stats["disabled_until"] = health.disabledUntil
+	}
+	return stats
+}
+
+// totals 返回所有账户的成功和失败总数
+func (t *healthTracker) totals() (int64, int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var sent, failed int64
+	for _, health := range t.accounts {
+		sent += health.successes
+		failed += health.failures
+	}
+	return sent, failed
+}
+
+// accountWeight 返回账户权重，未配置时为1
+func accountWeight(account config.SMTPAccountConfig) int {
+	if account.Weight <= 0 {
+		return 1
+	}
+	return account.Weight
+}
+
+// weightedOrder 按权重随机排序账户，权重越大越可能排在前面
+// 每个账户取 u^(1/weight) 作为排序键（u为(0,1)均匀随机数），按键降序排列
+func weightedOrder(accounts []config.SMTPAccountConfig) {
+	keys := make([]float64, len(accounts))
+	for i, account := range accounts {
+		keys[i] = math.Pow(rand.Float64(), 1/float64(accountWeight(account)))
+	}
+	sort.Sort(byKey{accounts, keys})
+}
+
+// byKey 按排序键降序排列账户
+type byKey struct {
+	accounts []config.SMTPAccountConfig
+	keys     []float64
+}
+
+func (b byKey) Len() int           { return len(b.accounts) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.accounts[i], b.accounts[j] = b.accounts[j], b.accounts[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
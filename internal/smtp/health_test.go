@@ -0,0 +1,86 @@
+package smtp
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"PushServer/internal/config"
+)
+
+func TestReserveCountsRecipients(t *testing.T) {
+	tracker := &healthTracker{accounts: make(map[string]*accountHealth)}
+	account := config.SMTPAccountConfig{Name: "gmail", Enabled: true, DailyLimit: 5}
+
+	day, ok := tracker.reserve(account, 3)
+	if !ok {
+		t.Fatal("reserve 3 of 5 failed")
+	}
+	// 预占的额度在发送完成前同样计入上限
+	if _, ok := tracker.reserve(account, 3); ok {
+		t.Fatal("reserve exceeded daily_limit while another message is sending")
+	}
+	tracker.recordSuccess(account.Name, day, 3, time.Millisecond)
+
+	day, ok = tracker.reserve(account, 2)
+	if !ok {
+		t.Fatal("reserve remaining 2 failed")
+	}
+	tracker.recordFailure(account.Name, day, 2, time.Millisecond, errors.New("550 rejected"), 3, time.Minute)
+
+	// 发送失败释放预占，只有成功投递的收件人计入sent_today
+	stats := tracker.snapshot(account)
+	if stats["sent_today"] != 3 || stats["status"] != AccountStatusHealthy {
+		t.Errorf("snapshot = %v", stats)
+	}
+	day, ok = tracker.reserve(account, 2)
+	if !ok {
+		t.Fatal("released quota not reusable")
+	}
+	tracker.recordSuccess(account.Name, day, 2, time.Millisecond)
+	if stats := tracker.snapshot(account); stats["status"] != AccountStatusExhausted {
+		t.Errorf("status after 5 recipients = %v", stats["status"])
+	}
+}
+
+func TestReserveIsAtomicAcrossSessions(t *testing.T) {
+	tracker := &healthTracker{accounts: make(map[string]*accountHealth)}
+	account := config.SMTPAccountConfig{Name: "gmail", Enabled: true, DailyLimit: 10}
+
+	var reserved atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if day, ok := tracker.reserve(account, 2); ok {
+				reserved.Add(2)
+				tracker.recordSuccess(account.Name, day, 2, time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved.Load() != 10 {
+		t.Errorf("reserved %d recipients, want 10", reserved.Load())
+	}
+	if stats := tracker.snapshot(account); stats["sent_today"] != 10 {
+		t.Errorf("sent_today = %v, want 10", stats["sent_today"])
+	}
+}
+
+func TestReserveSkipsStaleDay(t *testing.T) {
+	tracker := &healthTracker{accounts: make(map[string]*accountHealth)}
+	account := config.SMTPAccountConfig{Name: "gmail", Enabled: true, DailyLimit: 5}
+
+	if _, ok := tracker.reserve(account, 2); !ok {
+		t.Fatal("reserve failed")
+	}
+	// 预占后跨天，前一天的预占随当日统计清零，结算时不再计入新的一天
+	tracker.recordSuccess(account.Name, "2000-01-01", 2, time.Millisecond)
+	if stats := tracker.snapshot(account); stats["sent_today"] != 0 {
+		t.Errorf("sent_today = %v, want 0", stats["sent_today"])
+	}
+}
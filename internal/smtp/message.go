@@ -0,0 +1,309 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// wordDecoder 解码RFC 2047编码的邮件头，支持GBK、GB18030、Big5等常见字符集
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("不支持的字符集: %s", charset)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	},
+}
+
+// mimeHeaders 转发时原样保留的MIME内容头
+var mimeHeaders = []string{"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-Language"}
+
+// parseMessage 解析客户端通过DATA提交的原始邮件
+// 正文保持原始编码不做解码，multipart、quoted-printable/base64正文和附件按原样转发
+// 没有合法邮件头的内容（如cron、sendmail管道直接写入的文本）整体作为纯文本正文
+func parseMessage(raw []byte) (EmailMessage, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return plainTextMessage(raw), nil
+	}
+
+	body, err := io.ReadAll(message.Body)
+	if err != nil {
+		return EmailMessage{}, fmt.Errorf("读取邮件正文失败: %v", err)
+	}
+
+	msg := EmailMessage{
+		Subject:    decodeHeader(message.Header.Get("Subject")),
+		From:       message.Header.Get("From"),
+		HeaderTo:   message.Header.Get("To"),
+		Cc:         message.Header.Get("Cc"),
+		ReplyTo:    message.Header.Get("Reply-To"),
+		MessageID:  message.Header.Get("Message-Id"),
+		InReplyTo:  message.Header.Get("In-Reply-To"),
+		References: message.Header.Get("References"),
+		Date:       message.Header.Get("Date"),
+		Header:     message.Header,
+		MIME:       make(textproto.MIMEHeader),
+		RawBody:    body,
+	}
+	if msg.Subject == "" {
+		msg.Subject = "No Subject"
+	}
+	for _, name := range mimeHeaders {
+		if value := message.Header.Get(name); value != "" {
+			msg.MIME.Set(name, value)
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(msg.MIME.Get("Content-Type"))
+	msg.IsHTML = mediaType == "text/html"
+	return msg, nil
+}
+
+// plainTextMessage 将没有邮件头的内容作为UTF-8纯文本正文
+func plainTextMessage(raw []byte) EmailMessage {
+	msg := EmailMessage{
+		Subject:  "No Subject",
+		Header:   make(mail.Header),
+		MIME:     make(textproto.MIMEHeader),
+		RawBody:  raw,
+		NoHeader: true,
+	}
+	msg.MIME.Set("Content-Type", "text/plain; charset=UTF-8")
+	return msg
+}
+
+// maxMIMEDepth multipart嵌套的最大解析深度
+const maxMIMEDepth = 5
+
+var (
+	htmlBlockPattern = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|li|h[1-6])>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]+>`)
+	blankLinePattern = regexp.MustCompile(`\n[ \t]*\n(\s*\n)+`)
+)
+
+// textBody 提取邮件的纯文本正文，优先使用text/plain，没有时使用去掉标签的text/html，附件会被忽略
+func textBody(msg EmailMessage) string {
+	plain, html := extractText(msg.MIME, msg.RawBody, 0)
+	if plain == "" && html != "" {
+		plain = htmlToText(html)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(plain, "\r\n", "\n"))
+}
+
+// extractText 递归查找第一个text/plain和text/html部分
+func extractText(header textproto.MIMEHeader, body []byte, depth int) (string, string) {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(strings.ToLower(header.Get("Content-Disposition")), "attachment") {
+		return "", ""
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if depth >= maxMIMEDepth || params["boundary"] == "" {
+			return "", ""
+		}
+		var plain, html string
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				break
+			}
+			partBody, err := io.ReadAll(part)
+			if err != nil {
+				break
+			}
+			partPlain, partHTML := extractText(part.Header, partBody, depth+1)
+			if plain == "" {
+				plain = partPlain
+			}
+			if html == "" {
+				html = partHTML
+			}
+		}
+		return plain, html
+	case mediaType == "text/plain":
+		return decodePart(header, params["charset"], body), ""
+	case mediaType == "text/html":
+		return "", decodePart(header, params["charset"], body)
+	}
+	return "", ""
+}
+
+// decodePart 按Content-Transfer-Encoding和字符集解码文本部分
+func decodePart(header textproto.MIMEHeader, charset string, body []byte) string {
+	var reader io.Reader = bytes.NewReader(body)
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(reader)
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, newlineStripper{reader})
+	}
+
+	if charset != "" && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "us-ascii") {
+		if encoding, err := htmlindex.Get(charset); err == nil {
+			reader = encoding.NewDecoder().Reader(reader)
+		}
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil && len(decoded) == 0 {
+		return string(body)
+	}
+	return string(decoded)
+}
+
+// newlineStripper 去掉base64正文中的换行
+type newlineStripper struct {
+	reader io.Reader
+}
+
+func (r newlineStripper) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// htmlToText 将HTML正文粗略转换为纯文本
+func htmlToText(content string) string {
+	content = htmlBlockPattern.ReplaceAllString(content, "")
+	content = htmlBreakPattern.ReplaceAllString(content, "\n")
+	content = htmlTagPattern.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+	return blankLinePattern.ReplaceAllString(content, "\n\n")
+}
+
+// decodeHeader 解码RFC 2047编码的邮件头，无法解码时返回原值
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// 转发模式
+const (
+	ModeRebuild     = "rebuild"
+	ModePassthrough = "passthrough"
+)
+
+// From头处理策略
+const (
+	FromPolicyKeep    = "keep"
+	FromPolicyRewrite = "rewrite"
+)
+
+// passthroughContent 原样转发原始邮件，仅在rewrite策略下改写From头
+// 改写时原始From写入Reply-To(已有Reply-To时保留)，Bcc头始终移除，正文除行尾统一为CRLF外不做任何修改
+func passthroughContent(raw []byte, from, fromPolicy string) []byte {
+	raw = normalizeNewlines(raw)
+	header, body := splitRawMessage(raw)
+
+	fields := splitHeaderFields(header)
+	hasReplyTo := false
+	for _, field := range fields {
+		if name, _ := splitHeaderField(field); name == "reply-to" {
+			hasReplyTo = true
+		}
+	}
+
+	var result bytes.Buffer
+	for _, field := range fields {
+		name, value := splitHeaderField(field)
+		if name == "bcc" {
+			continue
+		}
+		if name == "from" && fromPolicy == FromPolicyRewrite {
+			// 在原位置改写，保持邮件头顺序
+			fmt.Fprintf(&result, "From: %s\r\n", from)
+			if !hasReplyTo && value != "" {
+				fmt.Fprintf(&result, "Reply-To: %s\r\n", value)
+			}
+			continue
+		}
+		result.Write(field)
+	}
+	result.Write(body)
+	return result.Bytes()
+}
+
+// normalizeNewlines 将单独的LF转换为CRLF，BDAT提交的内容可能只使用LF
+func normalizeNewlines(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// splitRawMessage 在第一个空行处拆分邮件头和正文，正文以该空行开头
+// 没有空行时整个内容都是邮件头，正文只有一个空行
+func splitRawMessage(raw []byte) ([]byte, []byte) {
+	if bytes.HasPrefix(raw, []byte("\r\n")) {
+		return nil, raw
+	}
+	if headerEnd := bytes.Index(raw, []byte("\r\n\r\n")); headerEnd >= 0 {
+		return raw[:headerEnd+2], raw[headerEnd+2:]
+	}
+	if !bytes.HasSuffix(raw, []byte("\r\n")) {
+		raw = append(raw, '\r', '\n')
+	}
+	return raw, []byte("\r\n")
+}
+
+// splitHeaderField 返回小写的字段名和去掉首尾空白的字段值
+func splitHeaderField(field []byte) (string, string) {
+	colon := bytes.IndexByte(field, ':')
+	if colon < 0 {
+		return "", ""
+	}
+	return strings.ToLower(strings.TrimSpace(string(field[:colon]))), strings.TrimSpace(string(field[colon+1:]))
+}
+
+// splitHeaderFields 按字段切分原始邮件头，折叠的续行归入所属字段，每个字段保留结尾的CRLF
+func splitHeaderFields(header []byte) [][]byte {
+	var fields [][]byte
+	for len(header) > 0 {
+		lineEnd := bytes.Index(header, []byte("\r\n"))
+		if lineEnd < 0 {
+			lineEnd = len(header)
+		} else {
+			lineEnd += 2
+		}
+		line := header[:lineEnd]
+		header = header[lineEnd:]
+
+		if len(fields) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			fields[len(fields)-1] = append(fields[len(fields)-1], line...)
+			continue
+		}
+		fields = append(fields, append([]byte(nil), line...))
+	}
+	return fields
+}
@@ -0,0 +1,161 @@
+package smtp
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"PushServer/internal/config"
+)
+
+// allowsSender 检查发件人是否在中继用户允许的地址或域名内
+func allowsSender(user config.SMTPRelayUserConfig, sender string) bool {
+	if len(user.AllowedSenders) == 0 {
+		return true
+	}
+	return matchAddress(user.AllowedSenders, sender)
+}
+
+// matchAddress 检查地址是否匹配任一规则
+// 规则可以是完整地址(alerts@example.com)、域名(example.com或@example.com)或子域通配(*.example.com)
+func matchAddress(rules []string, address string) bool {
+	address = strings.ToLower(address)
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if strings.Contains(strings.TrimPrefix(rule, "@"), "@") {
+			if address == rule {
+				return true
+			}
+			continue
+		}
+		if matchDomain(addressDomain(address), strings.TrimPrefix(rule, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsRecipient 检查收件人域名是否在中继用户允许的范围内
+func allowsRecipient(user config.SMTPRelayUserConfig, recipient string) bool {
+	if len(user.AllowedRecipientDomains) == 0 {
+		return true
+	}
+	domain := addressDomain(strings.ToLower(recipient))
+	for _, rule := range user.AllowedRecipientDomains {
+		if matchDomain(domain, strings.ToLower(strings.TrimSpace(rule))) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxMessageSize 返回中继用户的邮件大小限制，用户未配置或超过全局限制时使用全局限制
+func (s *SMTPServer) maxMessageSize(user config.SMTPRelayUserConfig) int {
+	limit := s.config.MaxMessageSize
+	if user.MaxMessageSize > 0 && (limit <= 0 || user.MaxMessageSize < limit) {
+		limit = user.MaxMessageSize
+	}
+	return limit
+}
+
+// addressDomain 返回邮件地址的域名部分
+func addressDomain(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return address[at+1:]
+}
+
+// matchDomain 匹配域名，pattern支持*.example.com形式匹配任意子域
+func matchDomain(domain, pattern string) bool {
+	if domain == "" || pattern == "" {
+		return false
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(domain, pattern[1:])
+	}
+	return domain == pattern
+}
+
+// quotaTracker 按自然日统计各中继用户提交的收件人数，重启后重新计数
+// 收件人在RCPT时即预占配额，投递失败或事务被重置时归还，避免并发会话超出配额
+type quotaTracker struct {
+	day    string
+	counts map[string]int
+	mutex  sync.Mutex
+}
+
+// quotas 中继用户每日配额统计
+var quotas = &quotaTracker{counts: make(map[string]int)}
+
+// rollover 跨天时清空计数，调用方需持有锁
+func (q *quotaTracker) rollover() {
+	today := time.Now().Format("2006-01-02")
+	if q.day != today {
+		q.day = today
+		q.counts = make(map[string]int)
+	}
+}
+
+// remaining 返回用户当天剩余的配额，limit<=0表示不限制
+func (q *quotaTracker) remaining(username string, limit int) (int, bool) {
+	if limit <= 0 {
+		return 0, true
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover()
+	left := limit - q.counts[username]
+	return left, left > 0
+}
+
+// reserve 为用户预占一个收件人的配额，返回预占所属的日期，limit<=0时只计数不限制
+func (q *quotaTracker) reserve(username string, limit int) (string, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover()
+	if limit > 0 && q.counts[username] >= limit {
+		return q.day, false
+	}
+	q.counts[username]++
+	return q.day, true
+}
+
+// release 归还预占的配额，跨天后旧日期的预占已随计数清空，无需归还
+func (q *quotaTracker) release(username, day string, n int) {
+	if n <= 0 {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover()
+	if q.day != day {
+		return
+	}
+	q.counts[username] -= n
+	if q.counts[username] <= 0 {
+		delete(q.counts, username)
+	}
+}
+
+// usage 返回各中继用户当天的收件人数(含进行中事务的预占)和配额
+func (q *quotaTracker) usage(users []config.SMTPRelayUserConfig) []map[string]interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover()
+
+	result := make([]map[string]interface{}, 0, len(users))
+	for _, user := range users {
+		result = append(result, map[string]interface{}{
+			"username":    user.Username,
+			"sent_today":  q.counts[user.Username],
+			"daily_quota": user.DailyQuota,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["username"].(string) < result[j]["username"].(string)
+	})
+	return result
+}
@@ -0,0 +1,159 @@
+package smtp
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxCommandLength 命令行最大长度，含CRLF(RFC 5321 4.5.3.1.4)
+	defaultMaxCommandLength = 512
+	// defaultMaxLineLength 邮件内容行最大长度，含CRLF
+	// RFC 5321 4.5.3.1.6规定的1000字节经常被客户端生成的HTML等长行突破，默认只限制到1MB防止单行占用过多内存
+	defaultMaxLineLength = 1 << 20
+	// authLineLength AUTH命令和认证响应的最大长度(RFC 4954 4)
+	authLineLength = 12288
+	// replyTimeout 会话结束前发送最后一条响应的超时时间
+	replyTimeout = 10 * time.Second
+	// shutdownTimeout 停止服务时等待会话结束的最长时间
+	shutdownTimeout = 30 * time.Second
+	// chunkBufferSize 读取BDAT数据块时每次读取的字节数
+	chunkBufferSize = 32 * 1024
+)
+
+var (
+	// errLineTooLong 行长度超过限制，该行剩余内容已被丢弃
+	errLineTooLong = errors.New("line too long")
+	// errSessionQuit 客户端发送QUIT，正常结束会话
+	errSessionQuit = errors.New("client quit")
+	// errServerStopping 服务正在停止，不再读取新的命令
+	errServerStopping = errors.New("server stopping")
+)
+
+// maxCommandLength 返回命令行最大长度
+func (s *SMTPServer) maxCommandLength() int {
+	if s.config.Server.MaxCommandLength > 0 {
+		return s.config.Server.MaxCommandLength
+	}
+	return defaultMaxCommandLength
+}
+
+// maxLineLength 返回DATA内容行最大长度
+func (s *SMTPServer) maxLineLength() int {
+	if s.config.Server.MaxLineLength > 0 {
+		return s.config.Server.MaxLineLength
+	}
+	return defaultMaxLineLength
+}
+
+// resetDeadline 按空闲超时重新设置连接的读写截止时间
+func (s *SMTPSession) resetDeadline() {
+	if timeout := s.server.config.Server.IdleTimeout; timeout > 0 {
+		s.conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+	} else {
+		s.conn.SetDeadline(time.Time{})
+	}
+}
+
+// readLine 读取一行，返回内容不含CRLF；长度(含CRLF)超过limit时丢弃整行并返回errLineTooLong
+// 逐段读取，超长行不会全部载入内存
+func (s *SMTPSession) readLine(limit int) (string, error) {
+	s.resetDeadline()
+	// 先设置截止时间再检查服务状态，Stop在标记停止后才让连接超时，两者之间不会遗漏
+	if !s.server.running.Load() {
+		return "", errServerStopping
+	}
+
+	var line []byte
+	tooLong := false
+	for {
+		chunk, isPrefix, err := s.reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(line)+2 > limit {
+				tooLong = true
+				line = nil
+			}
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	if tooLong {
+		return "", errLineTooLong
+	}
+	return string(line), nil
+}
+
+// readChunk 读取size字节的BDAT数据块并追加到data，每次读取前刷新空闲超时
+func (s *SMTPSession) readChunk(data []byte, size int64) ([]byte, error) {
+	buf := make([]byte, chunkBufferSize)
+	for size > 0 {
+		s.resetDeadline()
+		n := int64(len(buf))
+		if size < n {
+			n = size
+		}
+		read, err := io.ReadFull(s.reader, buf[:n])
+		data = append(data, buf[:read]...)
+		if err != nil {
+			return data, err
+		}
+		size -= int64(read)
+	}
+	return data, nil
+}
+
+// discardChunk 读取并丢弃size字节的BDAT数据块
+func (s *SMTPSession) discardChunk(size int64) error {
+	for size > 0 {
+		s.resetDeadline()
+		n := int64(chunkBufferSize)
+		if size < n {
+			n = size
+		}
+		discarded, err := s.reader.Discard(int(n))
+		if err != nil {
+			return err
+		}
+		size -= int64(discarded)
+	}
+	return nil
+}
+
+// parsePath 解析MAIL FROM:/RCPT TO:命令中的地址和参数，地址两侧的尖括号会被去掉
+func parsePath(parts []string, prefix string) (string, []string, bool) {
+	if len(parts) < 2 {
+		return "", nil, false
+	}
+	arg := strings.Join(parts[1:], " ")
+	if !strings.HasPrefix(strings.ToUpper(arg), prefix) {
+		return "", nil, false
+	}
+	fields := strings.Fields(arg[len(prefix):])
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	return strings.Trim(fields[0], "<>"), fields[1:], true
+}
+
+// isAuthCommand 是否为AUTH命令，AUTH携带初始响应时允许超过普通命令的长度限制
+func isAuthCommand(line string) bool {
+	return len(line) >= 5 && strings.EqualFold(line[:5], "AUTH ")
+}
+
+// isASCII 检查地址是否只包含ASCII字符
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
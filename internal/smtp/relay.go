@@ -2,18 +2,30 @@ package smtp
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"mime"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 	"time"
 
 	"PushServer/internal/config"
+	"PushServer/internal/dkim"
 	"PushServer/internal/logger"
+	"PushServer/internal/metrics"
 	"PushServer/internal/model"
 	"PushServer/internal/notification"
+	"PushServer/internal/redact"
 )
 
+// defaultAccountTimeout 未配置timeout时连接SMTP账户和等待其响应的超时时间
+const defaultAccountTimeout = 60 * time.Second
+
 // RelayService SMTP中继服务
 type RelayService struct {
 	config *config.SMTPRelayConfig
@@ -28,26 +40,84 @@ func NewRelayService() *RelayService {
 
 // EmailMessage 邮件消息结构
 type EmailMessage struct {
-	To      []string
-	Subject string
+	To      []string // 信封收件人，包含密送
+	Subject string   // 解码后的主题
 	Body    string
 	IsHTML  bool
+
+	// AuthUser 提交该邮件的中继用户
+	AuthUser string
+	// MailFrom 客户端提交的信封发件人，用于路由匹配，实际投递时使用账户地址
+	MailFrom string
+
+	// 以下字段来自客户端提交的原始邮件，转发时保留
+	From       string               // 原始From头
+	HeaderTo   string               // 原始To头，为空时使用信封收件人
+	Cc         string               // 原始Cc头
+	ReplyTo    string               // 原始Reply-To头
+	MessageID  string               // 原始Message-ID头
+	InReplyTo  string               // 原始In-Reply-To头
+	References string               // 原始References头
+	Date       string               // 原始Date头
+	Header     mail.Header          // 原始邮件头
+	MIME       textproto.MIMEHeader // Content-Type等MIME内容头
+	RawBody    []byte               // 原始编码的正文，不为nil时原样转发
+	Raw        []byte               // 客户端提交的完整DATA内容，passthrough模式下使用
+	NoHeader   bool                 // DATA内容没有邮件头，passthrough模式下也重新构建邮件
 }
 
-// SendEmail 发送邮件（通过SMTP中继）
+// SendEmail 发送邮件（通过SMTP中继），有收件人投递失败时触发系统通知
 func (rs *RelayService) SendEmail(msg EmailMessage) error {
+	if err := rs.deliver(msg); err != nil {
+		metrics.SMTPRelayDeliveryFailuresTotal.Inc()
+		rs.triggerSystemNotification(msg, err)
+		return err
+	}
+	return nil
+}
+
+// deliver 按路由规则拆分收件人，每个路由依次尝试其可用账户投递邮件
+// 部分路由失败时返回*partialDeliveryError，其中包含需要重新投递的收件人
+func (rs *RelayService) deliver(msg EmailMessage) error {
 	if !rs.config.Enabled {
 		return fmt.Errorf("SMTP中继功能未启用")
 	}
 
-	// 获取可用的SMTP账户
-	availableAccounts := rs.getAvailableAccounts()
+	routes := rs.planRoutes(msg)
+	if len(routes) == 1 {
+		return rs.deliverRoute(routes[0], msg)
+	}
+
+	result := &partialDeliveryError{}
+	for _, route := range routes {
+		routeMsg := msg
+		routeMsg.To = route.recipients
+		if err := rs.deliverRoute(route, routeMsg); err != nil {
+			result.Failed = append(result.Failed, route.recipients...)
+			result.errs = append(result.errs, fmt.Sprintf("路由 %s: %v", route.name, err))
+			continue
+		}
+		result.Delivered = append(result.Delivered, route.recipients...)
+	}
+	if len(result.Failed) > 0 {
+		return result
+	}
+	return nil
+}
+
+// deliverRoute 使用路由的账户投递邮件，按权重依次尝试
+func (rs *RelayService) deliverRoute(route deliveryRoute, msg EmailMessage) error {
+	availableAccounts := route.accounts
 	if len(availableAccounts) == 0 {
 		return fmt.Errorf("没有可用的SMTP账户")
 	}
 
-	// 随机打乱账户顺序
-	rs.shuffleAccounts(availableAccounts)
+	// 跳过冷却中和已达每日上限的账户，其余按权重随机排序
+	availableAccounts = accountHealthTracker.usable(availableAccounts)
+	if len(availableAccounts) == 0 {
+		return fmt.Errorf("所有SMTP账户都处于冷却中或已达到每日发送上限")
+	}
+	weightedOrder(availableAccounts)
 
 	var lastErr error
 	maxRetries := rs.config.MaxRetries
@@ -55,81 +125,179 @@ func (rs *RelayService) SendEmail(msg EmailMessage) error {
 		maxRetries = len(availableAccounts)
 	}
 
-	// 尝试发送邮件
-	for i, account := range availableAccounts {
-		if i >= maxRetries {
+	// 尝试发送邮件，每日上限按收件人数计算，发送前预占额度，剩余额度不足的账户跳过
+	attempts := 0
+	for _, account := range availableAccounts {
+		if attempts >= maxRetries {
 			break
 		}
+		day, ok := accountHealthTracker.reserve(account, len(msg.To))
+		if !ok {
+			logger.Debugf("SMTP账户 %s 剩余每日额度不足 %d 个收件人或已不可用，跳过", account.Name, len(msg.To))
+			continue
+		}
+		attempts++
 
-		logger.Infof("尝试使用SMTP账户发送邮件: %s (%s)", account.Name, account.Host)
+		logger.Infof("尝试使用SMTP账户发送邮件: %s (%s), 路由: %s, 收件人数: %d", account.Name, account.Host, route.name, len(msg.To))
 
+		startedAt := time.Now()
 		err := rs.sendEmailWithAccount(account, msg)
+		latency := time.Since(startedAt)
+		metrics.SMTPRelaySendDuration.WithLabelValues(account.Name).Observe(latency.Seconds())
 		if err == nil {
-			logger.Infof("邮件发送成功，使用账户: %s", account.Name)
+			accountHealthTracker.recordSuccess(account.Name, day, len(msg.To), latency)
+			metrics.SMTPRelayMessagesTotal.WithLabelValues(account.Name, "success").Inc()
+			logger.Infof("邮件发送成功，使用账户: %s, 中继用户: %s", account.Name, msg.AuthUser)
 			return nil
 		}
 
+		metrics.SMTPRelayMessagesTotal.WithLabelValues(account.Name, "failed").Inc()
 		logger.Warnf("SMTP账户 %s 发送失败: %v", account.Name, err)
+		if accountHealthTracker.recordFailure(account.Name, day, len(msg.To), latency, err, rs.failureThreshold(), rs.accountCooldown()) {
+			logger.Warnf("SMTP账户 %s 连续失败，暂停使用 %s", account.Name, rs.accountCooldown())
+		}
 		lastErr = err
 	}
 
-	// 所有账户都失败，触发系统通知
-	rs.triggerSystemNotification(msg, lastErr)
-
+	if lastErr == nil {
+		return fmt.Errorf("所有SMTP账户的剩余每日额度都不足以发送给 %d 个收件人", len(msg.To))
+	}
 	return fmt.Errorf("所有SMTP账户都发送失败，最后错误: %v", lastErr)
 }
 
+// allowsHeaderFrom 检查passthrough邮件能否保留原From头
+// DKIM按From头的域名签名，只有From属于中继用户允许的发件人或与账户地址同域时才能保留，否则会为他人的域名签发有效签名
+func (rs *RelayService) allowsHeaderFrom(msg EmailMessage, account config.SMTPAccountConfig) bool {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil || !dkim.CanSign(from.Address) {
+		return true
+	}
+	if strings.EqualFold(addressDomain(from.Address), addressDomain(account.From)) {
+		return true
+	}
+	for _, user := range rs.config.Users {
+		if user.Username == msg.AuthUser {
+			return allowsSender(user, from.Address)
+		}
+	}
+	return false
+}
+
 // sendEmailWithAccount 使用指定账户发送邮件
 func (rs *RelayService) sendEmailWithAccount(account config.SMTPAccountConfig, msg EmailMessage) error {
-	// 构建邮件内容
-	emailContent := rs.buildEmailContent(account.From, msg)
+	// 构建邮件内容，passthrough模式下原样转发DATA内容，信封发件人始终为账户地址
+	var emailContent string
+	if rs.config.Mode == ModePassthrough && msg.Raw != nil && !msg.NoHeader {
+		fromPolicy := account.FromPolicy
+		if fromPolicy != FromPolicyRewrite && !rs.allowsHeaderFrom(msg, account) {
+			logger.Warnf("邮件From头不在中继用户允许的发件人范围内，改写为账户地址后再签名: 用户名=%s, From=%s", msg.AuthUser, msg.From)
+			fromPolicy = FromPolicyRewrite
+		}
+		emailContent = string(passthroughContent(msg.Raw, account.From, fromPolicy))
+	} else {
+		emailContent = rs.buildEmailContent(account.From, msg)
+	}
+	if signed, err := dkim.Sign([]byte(emailContent)); err != nil {
+		logger.Warnf("邮件DKIM签名失败，将发送未签名的邮件: %v", err)
+	} else {
+		emailContent = string(signed)
+	}
 
 	// 建立SMTP连接
 	addr := fmt.Sprintf("%s:%d", account.Host, account.Port)
+	timeout := accountTimeout(account)
 
 	// 创建TLS配置
 	tlsConfig := &tls.Config{
 		ServerName: account.Host,
 	}
 
-	// 连接到SMTP服务器
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	// 连接到SMTP服务器，优先使用TLS
+	conn, err := dialAccount(addr, timeout)
 	if err != nil {
+		return &accountFailure{fmt.Errorf("连接SMTP服务器失败: %v", err)}
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return &accountFailure{fmt.Errorf("连接SMTP服务器超时: %v", err)}
+		}
+
 		// 尝试非TLS连接
-		client, err := smtp.Dial(addr)
+		conn, err = dialAccount(addr, timeout)
+		if err != nil {
+			return &accountFailure{fmt.Errorf("连接SMTP服务器失败: %v", err)}
+		}
+		client, err := smtp.NewClient(conn, account.Host)
 		if err != nil {
-			return fmt.Errorf("连接SMTP服务器失败: %v", err)
+			conn.Close()
+			return &accountFailure{fmt.Errorf("连接SMTP服务器失败: %v", err)}
 		}
 		defer client.Close()
 
 		// 尝试启用STARTTLS
 		if ok, _ := client.Extension("STARTTLS"); ok {
 			if err = client.StartTLS(tlsConfig); err != nil {
-				return fmt.Errorf("启用STARTTLS失败: %v", err)
+				return &accountFailure{fmt.Errorf("启用STARTTLS失败: %v", err)}
 			}
 		}
 
 		return rs.sendEmailWithClient(client, account, msg.To, emailContent)
 	}
-	defer conn.Close()
 
 	// 使用TLS连接创建SMTP客户端
-	client, err := smtp.NewClient(conn, account.Host)
+	client, err := smtp.NewClient(tlsConn, account.Host)
 	if err != nil {
-		return fmt.Errorf("创建SMTP客户端失败: %v", err)
+		tlsConn.Close()
+		return &accountFailure{fmt.Errorf("创建SMTP客户端失败: %v", err)}
 	}
 	defer client.Close()
 
 	return rs.sendEmailWithClient(client, account, msg.To, emailContent)
 }
 
+// accountTimeout 返回账户的连接和读写超时
+func accountTimeout(account config.SMTPAccountConfig) time.Duration {
+	if account.Timeout > 0 {
+		return time.Duration(account.Timeout) * time.Second
+	}
+	return defaultAccountTimeout
+}
+
+// dialAccount 连接SMTP账户，返回的连接在每次读写前重置超时，服务器停止响应时读写会失败而不是一直阻塞
+func dialAccount(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &deadlineConn{Conn: conn, timeout: timeout}, nil
+}
+
+// deadlineConn 每次读写前将截止时间设置为timeout之后
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
 // sendEmailWithClient 使用SMTP客户端发送邮件
 func (rs *RelayService) sendEmailWithClient(client *smtp.Client, account config.SMTPAccountConfig, to []string, content string) error {
 	// 身份验证
 	if account.Username != "" && account.Password != "" {
 		auth := smtp.PlainAuth("", account.Username, account.Password, account.Host)
 		if err := client.Auth(auth); err != nil {
-			return fmt.Errorf("SMTP身份验证失败: %v", err)
+			return &accountFailure{fmt.Errorf("SMTP身份验证失败: %v", err)}
 		}
 	}
 
@@ -150,33 +318,89 @@ func (rs *RelayService) sendEmailWithClient(client *smtp.Client, account config.
 	if err != nil {
 		return fmt.Errorf("开始发送邮件数据失败: %v", err)
 	}
-	defer writer.Close()
-
 	if _, err := writer.Write([]byte(content)); err != nil {
+		writer.Close()
 		return fmt.Errorf("写入邮件内容失败: %v", err)
 	}
+	// 服务器在DATA结束后才给出最终的接受或拒绝响应
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("邮件被SMTP服务器拒绝: %v", err)
+	}
 
+	// 邮件已被接受，QUIT失败不影响投递结果
+	if err := client.Quit(); err != nil {
+		logger.Debugf("SMTP账户 %s 结束会话失败: %v", account.Name, err)
+	}
 	return nil
 }
 
 // buildEmailContent 构建邮件内容
 func (rs *RelayService) buildEmailContent(from string, msg EmailMessage) string {
-	var contentType string
+	var content strings.Builder
+	writeHeader := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&content, "%s: %s\r\n", name, value)
+		}
+	}
+
+	to := msg.HeaderTo
+	if to == "" {
+		to = strings.Join(msg.To, ", ")
+	}
+	date := msg.Date
+	if date == "" {
+		date = time.Now().Format(time.RFC1123Z)
+	}
+	messageID := msg.MessageID
+	if messageID == "" {
+		messageID = generateMessageID(from)
+	}
+
+	writeHeader("From", from)
+	writeHeader("To", to)
+	writeHeader("Cc", msg.Cc)
+	writeHeader("Reply-To", msg.ReplyTo)
+	writeHeader("Subject", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	writeHeader("Date", date)
+	writeHeader("Message-ID", messageID)
+	writeHeader("In-Reply-To", msg.InReplyTo)
+	writeHeader("References", msg.References)
+	writeHeader("MIME-Version", "1.0")
+
+	if msg.RawBody != nil {
+		// 原样保留MIME内容头和已编码的正文，multipart边界和附件不受影响
+		contentType := msg.MIME.Get("Content-Type")
+		if contentType == "" {
+			contentType = "text/plain; charset=us-ascii"
+		}
+		writeHeader("Content-Type", contentType)
+		for _, name := range mimeHeaders[1:] {
+			writeHeader(name, msg.MIME.Get(name))
+		}
+		content.WriteString("\r\n")
+		content.Write(msg.RawBody)
+		return content.String()
+	}
+
+	contentType := "text/plain; charset=UTF-8"
 	if msg.IsHTML {
 		contentType = "text/html; charset=UTF-8"
-	} else {
-		contentType = "text/plain; charset=UTF-8"
 	}
+	writeHeader("Content-Type", contentType)
+	content.WriteString("\r\n")
+	content.WriteString(msg.Body)
+	return content.String()
+}
 
-	content := fmt.Sprintf("From: %s\r\n", from)
-	content += fmt.Sprintf("To: %s\r\n", strings.Join(msg.To, ", "))
-	content += fmt.Sprintf("Subject: %s\r\n", msg.Subject)
-	content += fmt.Sprintf("Content-Type: %s\r\n", contentType)
-	content += fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z))
-	content += "\r\n"
-	content += msg.Body
-
-	return content
+// generateMessageID 为缺少Message-ID的邮件生成新的ID
+func generateMessageID(from string) string {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 {
+			domain = address.Address[at+1:]
+		}
+	}
+	return fmt.Sprintf("<%d.%d@%s>", time.Now().UnixNano(), rand.Int63(), domain)
 }
 
 // getAvailableAccounts 获取可用的SMTP账户
@@ -190,24 +414,57 @@ func (rs *RelayService) getAvailableAccounts() []config.SMTPAccountConfig {
 	return available
 }
 
-// shuffleAccounts 随机打乱账户顺序
-func (rs *RelayService) shuffleAccounts(accounts []config.SMTPAccountConfig) {
-	rand.Seed(time.Now().UnixNano())
-	for i := len(accounts) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		accounts[i], accounts[j] = accounts[j], accounts[i]
+// AccountAvailability 返回已启用的账户名，以及其中未处于冷却且未达每日上限的账户名
+func (rs *RelayService) AccountAvailability() ([]string, []string) {
+	available := rs.getAvailableAccounts()
+	enabled := make([]string, 0, len(available))
+	for _, account := range available {
+		enabled = append(enabled, account.Name)
 	}
+	usable := make([]string, 0, len(available))
+	for _, account := range accountHealthTracker.usable(available) {
+		usable = append(usable, account.Name)
+	}
+	return enabled, usable
+}
+
+// failureThreshold 账户连续失败多少次后进入冷却
+func (rs *RelayService) failureThreshold() int {
+	if rs.config.AccountHealth.FailureThreshold > 0 {
+		return rs.config.AccountHealth.FailureThreshold
+	}
+	return defaultFailureThreshold
+}
+
+// accountCooldown 账户冷却时长
+func (rs *RelayService) accountCooldown() time.Duration {
+	if rs.config.AccountHealth.Cooldown > 0 {
+		return time.Duration(rs.config.AccountHealth.Cooldown) * time.Second
+	}
+	return defaultAccountCooldown
 }
 
 // triggerSystemNotification 触发系统通知
 func (rs *RelayService) triggerSystemNotification(msg EmailMessage, err error) {
-	// 构建系统通知内容
+	// 构建系统通知内容，拆分投递部分成功时只报告失败的收件人
 	title := "SMTP中继发送失败"
-	message := fmt.Sprintf("所有SMTP账户都无法发送邮件\n\n原始邮件信息:\n收件人: %s\n主题: %s\n\n错误信息: %v",
+	message := fmt.Sprintf("所有SMTP账户都无法发送邮件\n\n原始邮件信息:\n中继用户: %s\n收件人: %s\n主题: %s\n\n错误信息: %v",
+		msg.AuthUser,
 		strings.Join(msg.To, ", "),
 		msg.Subject,
 		err,
 	)
+	var partial *partialDeliveryError
+	if errors.As(err, &partial) && len(partial.Delivered) > 0 {
+		title = "SMTP中继部分投递失败"
+		message = fmt.Sprintf("部分收件人的邮件未能发送\n\n原始邮件信息:\n中继用户: %s\n已投递: %s\n投递失败: %s\n主题: %s\n\n错误信息: %v",
+			msg.AuthUser,
+			strings.Join(partial.Delivered, ", "),
+			strings.Join(partial.Failed, ", "),
+			msg.Subject,
+			err,
+		)
+	}
 
 	// 创建推送请求（用于系统通知）
 	pushReq := model.PushRequest{
@@ -222,8 +479,8 @@ func (rs *RelayService) triggerSystemNotification(msg EmailMessage, err error) {
 	}
 
 	// 添加到系统通知
-	notificationID := notification.Manager.AddNotification("", pushReq, "SMTP中继发送失败")
-	logger.Errorf("SMTP中继发送失败，已触发系统通知: %s", notificationID)
+	notificationID := notification.Manager.AddNotification("", pushReq, title)
+	logger.Errorf("%s，已触发系统通知: %s", title, notificationID)
 }
 
 // GetStatistics 获取SMTP中继统计信息
@@ -235,19 +492,32 @@ func (rs *RelayService) GetStatistics() map[string]interface{} {
 		"max_retries":        rs.config.MaxRetries,
 	}
 
-	// 账户详情
+	// 账户详情和健康状态
 	var accountStats []map[string]interface{}
 	for _, account := range rs.config.Accounts {
-		accountStats = append(accountStats, map[string]interface{}{
-			"name":    account.Name,
-			"host":    account.Host,
-			"port":    account.Port,
-			"from":    account.From,
-			"enabled": account.Enabled,
-		})
+		// 账户信息会通过接口返回，主机和发件人地址需要脱敏
+		accountStat := accountHealthTracker.snapshot(account)
+		accountStat["name"] = account.Name
+		accountStat["host"] = redact.Host(account.Host)
+		accountStat["port"] = account.Port
+		accountStat["from"] = redact.Email(account.From)
+		accountStat["enabled"] = account.Enabled
+		accountStats = append(accountStats, accountStat)
 	}
 	stats["accounts"] = accountStats
 
+	// 启动以来的发送总数和成功率
+	totalSent, totalFailed := accountHealthTracker.totals()
+	stats["total_sent"] = totalSent
+	stats["total_failed"] = totalFailed
+	stats["success_rate"] = 0.0
+	if totalSent+totalFailed > 0 {
+		stats["success_rate"] = math.Round(float64(totalSent)/float64(totalSent+totalFailed)*1000) / 10
+	}
+
+	// 中继用户当日提交数和配额
+	stats["users"] = quotas.usage(rs.config.Users)
+
 	return stats
 }
 
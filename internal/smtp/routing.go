@@ -0,0 +1,137 @@
+package smtp
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"PushServer/internal/config"
+)
+
+// defaultRouteName 未匹配任何路由规则的收件人使用的路由
+const defaultRouteName = "default"
+
+// deliveryRoute 一次投递：同一路由的收件人通过该路由的账户一起发送
+type deliveryRoute struct {
+	name       string
+	accounts   []config.SMTPAccountConfig
+	recipients []string
+}
+
+// partialDeliveryError 拆分投递时部分路由失败，Failed为需要重新投递的收件人
+type partialDeliveryError struct {
+	Delivered []string
+	Failed    []string
+	errs      []string
+}
+
+func (e *partialDeliveryError) Error() string {
+	return fmt.Sprintf("%d个收件人投递成功，%d个收件人投递失败: %s",
+		len(e.Delivered), len(e.Failed), strings.Join(e.errs, "; "))
+}
+
+// validateRoutes 检查路由规则引用的账户是否存在
+func validateRoutes(relayConfig *config.SMTPRelayConfig) error {
+	names := make(map[string]bool, len(relayConfig.Accounts))
+	for _, account := range relayConfig.Accounts {
+		names[account.Name] = true
+	}
+	for i, route := range relayConfig.Routes {
+		if len(route.Accounts) == 0 {
+			return fmt.Errorf("SMTP中继路由 %s 未配置accounts", routeName(route, i))
+		}
+		for _, name := range route.Accounts {
+			if !names[name] {
+				return fmt.Errorf("SMTP中继路由 %s 引用了不存在的账户: %s", routeName(route, i), name)
+			}
+		}
+	}
+	return nil
+}
+
+// routeName 返回路由名称，未配置时使用序号
+func routeName(route config.SMTPRouteConfig, index int) string {
+	if route.Name != "" {
+		return route.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// planRoutes 按路由规则拆分收件人，按规则顺序返回，未匹配的收件人放在最后的默认路由中
+func (rs *RelayService) planRoutes(msg EmailMessage) []deliveryRoute {
+	available := rs.getAvailableAccounts()
+	if len(rs.config.Routes) == 0 {
+		return []deliveryRoute{{name: defaultRouteName, accounts: available, recipients: msg.To}}
+	}
+
+	sender := envelopeSender(msg)
+	groups := make([][]string, len(rs.config.Routes)+1)
+	for _, recipient := range msg.To {
+		index := len(rs.config.Routes)
+		for i, route := range rs.config.Routes {
+			if matchRoute(route, sender, recipient) {
+				index = i
+				break
+			}
+		}
+		groups[index] = append(groups[index], recipient)
+	}
+
+	var routes []deliveryRoute
+	for i, route := range rs.config.Routes {
+		if len(groups[i]) == 0 {
+			continue
+		}
+		routes = append(routes, deliveryRoute{
+			name:       routeName(route, i),
+			accounts:   filterAccounts(available, route.Accounts),
+			recipients: groups[i],
+		})
+	}
+	if recipients := groups[len(rs.config.Routes)]; len(recipients) > 0 {
+		routes = append(routes, deliveryRoute{name: defaultRouteName, accounts: available, recipients: recipients})
+	}
+	return routes
+}
+
+// matchRoute 检查收件人是否匹配路由规则，未配置的条件视为匹配
+func matchRoute(route config.SMTPRouteConfig, sender, recipient string) bool {
+	if len(route.Senders) > 0 && (sender == "" || !matchAddress(route.Senders, sender)) {
+		return false
+	}
+	if len(route.RecipientDomains) == 0 {
+		return true
+	}
+	domain := addressDomain(strings.ToLower(recipient))
+	for _, pattern := range route.RecipientDomains {
+		if matchDomain(domain, strings.ToLower(strings.TrimSpace(pattern))) {
+			return true
+		}
+	}
+	return false
+}
+
+// envelopeSender 返回用于路由匹配的发件人：优先使用信封发件人，其次为From头中的地址
+func envelopeSender(msg EmailMessage) string {
+	if msg.MailFrom != "" {
+		return msg.MailFrom
+	}
+	if address, err := mail.ParseAddress(msg.From); err == nil {
+		return address.Address
+	}
+	return ""
+}
+
+// filterAccounts 按名称从可用账户中筛选路由使用的账户
+func filterAccounts(accounts []config.SMTPAccountConfig, names []string) []config.SMTPAccountConfig {
+	var filtered []config.SMTPAccountConfig
+	for _, account := range accounts {
+		for _, name := range names {
+			if account.Name == name {
+				filtered = append(filtered, account)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -2,21 +2,40 @@ package smtp
 
 import (
 	"bufio"
-	"encoding/base64"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/textproto"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"PushServer/internal/audit"
 	"PushServer/internal/config"
 	"PushServer/internal/logger"
+	"PushServer/internal/metrics"
+	"PushServer/internal/model"
+	"PushServer/internal/tlsutil"
 )
 
 // SMTPServer SMTP中继服务器
 type SMTPServer struct {
-	config   *config.SMTPRelayConfig
-	relay    *RelayService
-	listener net.Listener
+	config           *config.SMTPRelayConfig
+	relay            *RelayService
+	listener         net.Listener
+	implicitListener net.Listener
+	tlsConfig        *tls.Config
+	running          atomic.Bool
+	acceptWG         sync.WaitGroup
+	sessionWG        sync.WaitGroup
+
+	// 活动连接，用于限制并发连接数和停止时断开空闲会话
+	conns     map[net.Conn]struct{}
+	connMutex sync.Mutex
 }
 
 // NewSMTPServer 创建SMTP服务器实例
@@ -24,6 +43,7 @@ func NewSMTPServer() *SMTPServer {
 	return &SMTPServer{
 		config: &config.AppConfig.SMTPRelay,
 		relay:  NewRelayService(),
+		conns:  make(map[net.Conn]struct{}),
 	}
 }
 
@@ -34,50 +54,193 @@ func (s *SMTPServer) Start() error {
 		return nil
 	}
 
+	switch s.config.Mode {
+	case "", ModeRebuild, ModePassthrough:
+	default:
+		return fmt.Errorf("无效的SMTP中继转发模式: %s", s.config.Mode)
+	}
+	for _, account := range s.config.Accounts {
+		switch account.FromPolicy {
+		case "", FromPolicyKeep, FromPolicyRewrite:
+		default:
+			return fmt.Errorf("SMTP账户 %s 的from_policy无效: %s", account.Name, account.FromPolicy)
+		}
+	}
+	if err := validateRoutes(s.config); err != nil {
+		return err
+	}
+
+	if s.config.TLS.CertFile != "" {
+		reloader, err := tlsutil.NewCertReloader(s.config.TLS.CertFile, s.config.TLS.KeyFile,
+			time.Duration(s.config.TLS.ReloadInterval)*time.Second)
+		if err != nil {
+			return fmt.Errorf("加载SMTP中继TLS证书失败: %v", err)
+		}
+		s.tlsConfig = &tls.Config{
+			MinVersion:     tlsutil.ParseMinVersion(s.config.TLS.MinVersion),
+			GetCertificate: reloader.GetCertificate,
+		}
+	} else if s.config.TLS.RequireTLS || s.config.TLS.ImplicitPort > 0 {
+		return fmt.Errorf("SMTP中继启用require_tls或implicit_port时必须配置tls.cert_file和tls.key_file")
+	}
+
 	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("启动SMTP服务器失败: %v", err)
 	}
-
 	s.listener = listener
-	logger.Infof("SMTP中继服务器启动在 %s", addr)
 
-	go s.acceptConnections()
+	// 隐式TLS端口，连接建立后直接进行TLS握手
+	if s.config.TLS.ImplicitPort > 0 {
+		implicitAddr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.TLS.ImplicitPort)
+		implicitListener, err := net.Listen("tcp", implicitAddr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("启动SMTPS监听失败: %v", err)
+		}
+		s.implicitListener = tls.NewListener(implicitListener, s.tlsConfig)
+		logger.Infof("SMTP中继隐式TLS端口启动在 %s", implicitAddr)
+	}
+
+	s.running.Store(true)
+	logger.Infof("SMTP中继服务器启动在 %s, STARTTLS: %v, 要求TLS: %v, 最大连接数: %d",
+		addr, s.tlsConfig != nil, s.config.TLS.RequireTLS, s.config.Server.MaxConnections)
+
+	s.acceptWG.Add(1)
+	go s.acceptConnections(s.listener, false)
+	if s.implicitListener != nil {
+		s.acceptWG.Add(1)
+		go s.acceptConnections(s.implicitListener, true)
+	}
 	return nil
 }
 
-// Stop 停止SMTP服务器
+// Stop 停止SMTP服务器：关闭监听并等待接受连接的协程退出，空闲会话回复421后断开
+// 正在投递邮件的会话最多等待shutdownTimeout
 func (s *SMTPServer) Stop() error {
+	if !s.running.Swap(false) {
+		return nil
+	}
+
+	var err error
+	if s.implicitListener != nil {
+		s.implicitListener.Close()
+	}
 	if s.listener != nil {
-		return s.listener.Close()
+		err = s.listener.Close()
 	}
-	return nil
+	s.acceptWG.Wait()
+
+	// 让正在等待命令的会话立即超时，会话检测到服务停止后回复421
+	s.connMutex.Lock()
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.connMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.sessionWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		logger.Warnf("等待SMTP会话结束超时(%s)，强制停止", shutdownTimeout)
+	}
+
+	logger.Info("SMTP中继服务器已停止")
+	return err
 }
 
-// acceptConnections 接受连接
-func (s *SMTPServer) acceptConnections() {
+// IsEnabled 检查SMTP中继服务器是否启用
+func (s *SMTPServer) IsEnabled() bool {
+	return s.config.Enabled
+}
+
+// IsRunning 检查SMTP中继服务器是否正在监听
+func (s *SMTPServer) IsRunning() bool {
+	return s.running.Load()
+}
+
+// Addr 获取监听地址
+func (s *SMTPServer) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// acceptConnections 接受连接，implicitTLS表示连接已经是TLS连接
+// 监听关闭后退出；其他错误（如文件描述符耗尽）按指数退避重试，避免空转
+func (s *SMTPServer) acceptConnections(listener net.Listener, implicitTLS bool) {
+	defer s.acceptWG.Done()
+
+	var delay time.Duration
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			logger.Errorf("接受SMTP连接失败: %v", err)
+			if !s.running.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			logger.Errorf("接受SMTP连接失败: %v，%s后重试", err, delay)
+			time.Sleep(delay)
 			continue
 		}
+		delay = 0
 
-		go s.handleConnection(conn)
+		if !s.trackConn(conn) {
+			logger.Warnf("SMTP中继连接数已达上限(%d)，拒绝连接: %s", s.config.Server.MaxConnections, conn.RemoteAddr())
+			conn.SetWriteDeadline(time.Now().Add(replyTimeout))
+			fmt.Fprintf(conn, "421 4.3.2 Too many connections, try again later\r\n")
+			conn.Close()
+			continue
+		}
+		s.sessionWG.Add(1)
+		go s.handleConnection(conn, implicitTLS)
 	}
 }
 
+// trackConn 记录活动连接，超过最大连接数时返回false
+func (s *SMTPServer) trackConn(conn net.Conn) bool {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+
+	if max := s.config.Server.MaxConnections; max > 0 && len(s.conns) >= max {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrackConn 移除活动连接
+func (s *SMTPServer) untrackConn(conn net.Conn) {
+	s.connMutex.Lock()
+	delete(s.conns, conn)
+	s.connMutex.Unlock()
+}
+
 // handleConnection 处理SMTP连接
-func (s *SMTPServer) handleConnection(conn net.Conn) {
+func (s *SMTPServer) handleConnection(conn net.Conn, implicitTLS bool) {
+	defer s.sessionWG.Done()
+	defer s.untrackConn(conn)
 	defer conn.Close()
 
+	metrics.SMTPRelaySessionsTotal.Inc()
+	metrics.SMTPRelayActiveSessions.Inc()
+	defer metrics.SMTPRelayActiveSessions.Dec()
+
 	session := &SMTPSession{
-		conn:   conn,
 		server: s,
-		reader: textproto.NewReader(bufio.NewReader(conn)),
-		writer: textproto.NewWriter(bufio.NewWriter(conn)),
+		tls:    implicitTLS,
 	}
+	session.setConn(conn)
 
 	session.handle()
 }
@@ -86,44 +249,99 @@ func (s *SMTPServer) handleConnection(conn net.Conn) {
 type SMTPSession struct {
 	conn   net.Conn
 	server *SMTPServer
-	reader *textproto.Reader
+	reader *bufio.Reader
 	writer *textproto.Writer
 
 	// 会话状态
-	helo     string
-	mailFrom string
-	rcptTo   []string
-	data     []string
+	helo string
+
+	// 邮件事务状态，MAIL开始，DATA/BDAT LAST结束或RSET时清空
+	transaction bool
+	mailFrom    string
+	smtpUTF8    bool // MAIL FROM携带SMTPUTF8参数，允许非ASCII地址
+	rcptTo      []string
+	data        []byte
+	chunking    bool // 已通过BDAT接收数据块，不能再使用DATA
+
+	// 本次事务已预占的配额，事务结束前未投递成功时归还
+	quotaDay      string
+	quotaReserved int
 
 	// 认证状态
 	authenticated bool
 	username      string
+	user          config.SMTPRelayUserConfig // 认证用户的配置，用于发件人、收件人和大小限制
+
+	// 是否已建立TLS(STARTTLS或隐式TLS)
+	tls bool
+}
+
+// setConn 设置会话连接，STARTTLS升级后使用TLS连接重新创建读写器
+// 重新创建读取器会丢弃升级前客户端流水线发送的明文数据，防止命令注入
+func (s *SMTPSession) setConn(conn net.Conn) {
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	s.writer = textproto.NewWriter(bufio.NewWriter(conn))
 }
 
 // handle 处理SMTP会话
 func (s *SMTPSession) handle() {
-	// 发送欢迎消息
-	s.writer.PrintfLine("220 %s SMTP Relay Server Ready", s.server.config.Server.Host)
+	// 连接中断时归还进行中事务预占的配额
+	defer s.resetTransaction()
+
+	// 发送欢迎消息，隐式TLS连接在此时完成握手，同样受空闲超时限制
+	s.resetDeadline()
+	s.writer.PrintfLine("220 %s ESMTP SMTP Relay Server Ready", s.server.config.Server.Host)
 
 	for {
-		line, err := s.reader.ReadLine()
+		// AUTH命令携带初始响应时可能较长，按RFC 4954的上限读取，其余命令再按命令长度限制检查
+		line, err := s.readLine(authLineLength)
+		if err == nil && len(line)+2 > s.server.maxCommandLength() && !isAuthCommand(line) {
+			err = errLineTooLong
+		}
+		if errors.Is(err, errLineTooLong) {
+			if err := s.writer.PrintfLine("500 5.5.2 Line too long"); err != nil {
+				return
+			}
+			continue
+		}
 		if err != nil {
-			logger.Errorf("读取SMTP命令失败: %v", err)
+			s.closeWithError(err)
 			return
 		}
 
 		if err := s.processCommand(line); err != nil {
-			logger.Errorf("处理SMTP命令失败: %v", err)
+			if !errors.Is(err, errSessionQuit) {
+				s.closeWithError(err)
+			}
 			return
 		}
 	}
 }
 
+// closeWithError 会话读写失败时结束会话：空闲超时或服务停止时回复421，客户端断开不记录错误
+func (s *SMTPSession) closeWithError(err error) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errServerStopping) || (!s.server.running.Load() && errors.As(err, &netErr) && netErr.Timeout()):
+		s.conn.SetWriteDeadline(time.Now().Add(replyTimeout))
+		s.writer.PrintfLine("421 4.3.0 %s Service shutting down", s.server.config.Server.Host)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		logger.Infof("SMTP会话空闲超时: %s", s.conn.RemoteAddr())
+		s.conn.SetWriteDeadline(time.Now().Add(replyTimeout))
+		s.writer.PrintfLine("421 4.4.2 %s Idle timeout, closing connection", s.server.config.Server.Host)
+	case errors.Is(err, io.EOF):
+		logger.Debugf("SMTP客户端断开连接: %s", s.conn.RemoteAddr())
+	default:
+		logger.Errorf("处理SMTP会话失败: %v", err)
+	}
+}
+
 // processCommand 处理SMTP命令
 func (s *SMTPSession) processCommand(line string) error {
 	parts := strings.Fields(line)
 	if len(parts) == 0 {
-		return s.writer.PrintfLine("500 Command not recognized")
+		return s.writer.PrintfLine("500 5.5.2 Syntax error, command unrecognized")
 	}
 
 	command := strings.ToUpper(parts[0])
@@ -131,6 +349,8 @@ func (s *SMTPSession) processCommand(line string) error {
 	switch command {
 	case "HELO", "EHLO":
 		return s.handleHelo(parts)
+	case "STARTTLS":
+		return s.handleStartTLS()
 	case "AUTH":
 		return s.handleAuth(parts)
 	case "MAIL":
@@ -139,29 +359,54 @@ func (s *SMTPSession) processCommand(line string) error {
 		return s.handleRcpt(parts)
 	case "DATA":
 		return s.handleData()
+	case "BDAT":
+		return s.handleBdat(parts)
 	case "RSET":
 		return s.handleRset()
+	case "NOOP":
+		return s.writer.PrintfLine("250 2.0.0 OK")
+	case "VRFY":
+		if len(parts) < 2 {
+			return s.writer.PrintfLine("501 5.5.4 Syntax: VRFY <address>")
+		}
+		// 不泄露地址是否存在(RFC 5321 3.5.3)
+		return s.writer.PrintfLine("252 2.5.0 Cannot VRFY user, but will accept message and attempt delivery")
+	case "HELP":
+		return s.writer.PrintfLine("214 2.0.0 Supported commands: HELO EHLO STARTTLS AUTH MAIL RCPT DATA BDAT RSET NOOP VRFY HELP QUIT")
 	case "QUIT":
-		s.writer.PrintfLine("221 Bye")
-		return fmt.Errorf("client quit")
+		s.writer.PrintfLine("221 2.0.0 Bye")
+		return errSessionQuit
 	default:
-		return s.writer.PrintfLine("500 Command not recognized")
+		return s.writer.PrintfLine("500 5.5.1 Command not recognized")
 	}
 }
 
-// handleHelo 处理HELO/EHLO命令
+// handleHelo 处理HELO/EHLO命令，EHLO后重置邮件事务(RFC 5321 4.1.4)
 func (s *SMTPSession) handleHelo(parts []string) error {
 	if len(parts) < 2 {
-		return s.writer.PrintfLine("501 Syntax error")
+		return s.writer.PrintfLine("501 5.5.4 Syntax: %s <hostname>", strings.ToUpper(parts[0]))
 	}
 
 	s.helo = parts[1]
+	s.resetTransaction()
 
 	if strings.ToUpper(parts[0]) == "EHLO" {
 		s.writer.PrintfLine("250-%s", s.server.config.Server.Host)
-		s.writer.PrintfLine("250-AUTH PLAIN LOGIN")
-		s.writer.PrintfLine("250-STARTTLS")
-		s.writer.PrintfLine("250 8BITMIME")
+		// 要求TLS时，建立TLS之前不公布AUTH，避免客户端明文发送凭证
+		if s.tls || !s.server.config.TLS.RequireTLS {
+			s.writer.PrintfLine("250-AUTH %s", s.server.authMechanisms())
+		}
+		if s.server.tlsConfig != nil && !s.tls {
+			s.writer.PrintfLine("250-STARTTLS")
+		}
+		if s.server.config.MaxMessageSize > 0 {
+			s.writer.PrintfLine("250-SIZE %d", s.server.config.MaxMessageSize)
+		}
+		s.writer.PrintfLine("250-PIPELINING")
+		s.writer.PrintfLine("250-8BITMIME")
+		s.writer.PrintfLine("250-SMTPUTF8")
+		s.writer.PrintfLine("250-CHUNKING")
+		s.writer.PrintfLine("250 ENHANCEDSTATUSCODES")
 	} else {
 		s.writer.PrintfLine("250 %s", s.server.config.Server.Host)
 	}
@@ -169,154 +414,250 @@ func (s *SMTPSession) handleHelo(parts []string) error {
 	return nil
 }
 
-// handleAuth 处理AUTH命令
-func (s *SMTPSession) handleAuth(parts []string) error {
-	if len(parts) < 2 {
-		return s.writer.PrintfLine("501 Syntax error")
+// handleStartTLS 处理STARTTLS命令，握手成功后按RFC 3207重置会话状态
+func (s *SMTPSession) handleStartTLS() error {
+	if s.server.tlsConfig == nil {
+		return s.writer.PrintfLine("502 5.5.1 STARTTLS not supported")
 	}
-
-	// 简单的认证实现，检查配置的用户名密码
-	authType := strings.ToUpper(parts[1])
-
-	switch authType {
-	case "PLAIN":
-		return s.handleAuthPlain(parts)
-	case "LOGIN":
-		return s.handleAuthLogin()
-	default:
-		return s.writer.PrintfLine("504 Authentication mechanism not supported")
+	if s.tls {
+		return s.writer.PrintfLine("503 5.5.1 TLS already active")
 	}
-}
 
-// handleAuthPlain 处理PLAIN认证
-func (s *SMTPSession) handleAuthPlain(parts []string) error {
-	if len(parts) < 3 {
-		return s.writer.PrintfLine("501 Syntax error")
+	if err := s.writer.PrintfLine("220 2.0.0 Ready to start TLS"); err != nil {
+		return err
 	}
 
-	// 简单验证：检查配置的用户名密码
-	expectedUsername := s.server.config.Auth.Username
-	expectedPassword := s.server.config.Auth.Password
-
-	// 这里应该解析base64编码的认证信息，为了简化直接比较
-	if expectedUsername != "" && expectedPassword != "" {
-		s.authenticated = true
-		s.username = expectedUsername
-		return s.writer.PrintfLine("235 Authentication successful")
+	s.resetDeadline()
+	tlsConn := tls.Server(s.conn, s.server.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("STARTTLS握手失败: %v", err)
 	}
 
-	return s.writer.PrintfLine("535 Authentication failed")
+	s.setConn(tlsConn)
+	s.tls = true
+	s.helo = ""
+	s.authenticated = false
+	s.username = ""
+	s.user = config.SMTPRelayUserConfig{}
+	s.resetTransaction()
+	return nil
 }
 
-// handleAuthLogin 处理LOGIN认证
-func (s *SMTPSession) handleAuthLogin() error {
-	s.writer.PrintfLine("334 VXNlcm5hbWU6") // "Username:" base64编码
-
-	usernameBase64, err := s.reader.ReadLine()
-	if err != nil {
-		return err
+// handleAuth 处理AUTH命令
+func (s *SMTPSession) handleAuth(parts []string) error {
+	if len(parts) < 2 {
+		return s.writer.PrintfLine("501 5.5.4 Syntax: AUTH <mechanism> [initial-response]")
 	}
 
-	// 解码用户名
-	usernameBytes, err := base64.StdEncoding.DecodeString(usernameBase64)
-	if err != nil {
-		logger.Errorf("解码用户名失败: %v", err)
-		return s.writer.PrintfLine("535 Authentication failed")
+	if s.server.config.TLS.RequireTLS && !s.tls {
+		return s.writer.PrintfLine("530 5.7.0 Must issue a STARTTLS command first")
 	}
-	username := string(usernameBytes)
-
-	s.writer.PrintfLine("334 UGFzc3dvcmQ6") // "Password:" base64编码
-
-	passwordBase64, err := s.reader.ReadLine()
-	if err != nil {
-		return err
+	if s.authenticated {
+		return s.writer.PrintfLine("503 5.5.1 Already authenticated")
+	}
+	if s.mailFrom != "" {
+		return s.writer.PrintfLine("503 5.5.1 AUTH not permitted during a mail transaction")
 	}
 
-	// 解码密码
-	passwordBytes, err := base64.StdEncoding.DecodeString(passwordBase64)
-	if err != nil {
-		logger.Errorf("解码密码失败: %v", err)
-		return s.writer.PrintfLine("535 Authentication failed")
+	var initial string
+	if len(parts) > 2 {
+		initial = parts[2]
 	}
-	password := string(passwordBytes)
 
-	// 验证用户名密码
-	expectedUsername := s.server.config.Auth.Username
-	expectedPassword := s.server.config.Auth.Password
+	mechanism := strings.ToUpper(parts[1])
+	var username string
+	var ok bool
+	var err error
+	switch mechanism {
+	case mechanismPlain:
+		username, ok, err = s.authPlain(initial)
+	case mechanismLogin:
+		username, ok, err = s.authLogin(initial)
+	case mechanismCRAMMD5:
+		if !s.server.cramMD5Enabled() {
+			return s.writer.PrintfLine("504 5.5.4 Authentication mechanism not supported")
+		}
+		username, ok, err = s.authCRAMMD5()
+	default:
+		return s.writer.PrintfLine("504 5.5.4 Authentication mechanism not supported")
+	}
+
+	switch err {
+	case nil:
+	case errAuthCancelled:
+		return s.writer.PrintfLine("501 5.0.0 Authentication cancelled")
+	case errLineTooLong:
+		return s.writer.PrintfLine("500 5.5.6 Authentication exchange line is too long")
+	case errAuthMalformed:
+		s.recordAudit(audit.ActionSMTPAuth, mechanism, audit.ResultFailure, map[string]interface{}{"error": err.Error()})
+		return s.writer.PrintfLine("501 5.5.2 Cannot decode response")
+	default:
+		// 连接读取失败，结束会话
+		return err
+	}
 
-	if username == expectedUsername && password == expectedPassword {
-		s.authenticated = true
-		s.username = username
-		logger.Infof("SMTP认证成功: 用户名=%s", username)
-		return s.writer.PrintfLine("235 Authentication successful")
+	if !ok {
+		logger.Warnf("SMTP认证失败: 机制=%s, 用户名=%s", mechanism, username)
+		s.recordAudit(audit.ActionSMTPAuth, mechanism, audit.ResultFailure, map[string]interface{}{"username": username})
+		return s.writer.PrintfLine("535 5.7.8 Authentication credentials invalid")
 	}
 
-	logger.Warnf("SMTP认证失败: 用户名=%s, 期望用户名=%s", username, expectedUsername)
-	return s.writer.PrintfLine("535 Authentication failed")
+	s.authenticated = true
+	s.username = username
+	s.user, _ = s.server.findUser(username)
+	logger.Infof("SMTP认证成功: 机制=%s, 用户名=%s", mechanism, username)
+	s.recordAudit(audit.ActionSMTPAuth, mechanism, audit.ResultSuccess, nil)
+	return s.writer.PrintfLine("235 2.7.0 Authentication successful")
 }
 
-// handleMail 处理MAIL FROM命令
+// handleMail 处理MAIL FROM命令，支持SIZE、BODY和SMTPUTF8参数
 func (s *SMTPSession) handleMail(parts []string) error {
 	if !s.authenticated {
-		return s.writer.PrintfLine("530 Authentication required")
+		return s.writer.PrintfLine("530 5.7.0 Authentication required")
+	}
+	if s.transaction {
+		return s.writer.PrintfLine("503 5.5.1 Sender already specified")
+	}
+
+	// 解析发件人地址和参数(如SIZE=12345)
+	mailFrom, params, ok := parsePath(parts, "FROM:")
+	if !ok {
+		return s.writer.PrintfLine("501 5.5.4 Syntax: MAIL FROM:<address> [parameters]")
+	}
+
+	limit := s.server.maxMessageSize(s.user)
+	smtpUTF8 := false
+	for _, param := range params {
+		name, value, _ := strings.Cut(param, "=")
+		switch strings.ToUpper(name) {
+		case "SIZE":
+			size, err := strconv.Atoi(value)
+			if err != nil || size < 0 {
+				return s.writer.PrintfLine("501 5.5.4 Invalid SIZE parameter")
+			}
+			if limit > 0 && size > limit {
+				return s.writer.PrintfLine("552 5.3.4 Message size exceeds fixed limit of %d bytes", limit)
+			}
+		case "BODY":
+			switch strings.ToUpper(value) {
+			case "7BIT", "8BITMIME":
+			default:
+				return s.writer.PrintfLine("555 5.5.4 Unsupported BODY type: %s", value)
+			}
+		case "SMTPUTF8":
+			smtpUTF8 = true
+		case "AUTH":
+			// RFC 4954 AUTH=<mailbox>，中继按会话认证用户处理，忽略该参数
+		default:
+			return s.writer.PrintfLine("555 5.5.4 Unsupported MAIL parameter: %s", name)
+		}
 	}
-
-	if len(parts) < 2 {
-		return s.writer.PrintfLine("501 Syntax error")
+	if !smtpUTF8 && !isASCII(mailFrom) {
+		return s.writer.PrintfLine("553 5.6.7 Non-ASCII address requires SMTPUTF8")
 	}
 
-	// 解析发件人地址
-	mailFrom := strings.Join(parts[1:], " ")
-	if strings.HasPrefix(strings.ToUpper(mailFrom), "FROM:") {
-		mailFrom = strings.TrimSpace(mailFrom[5:])
+	if !allowsSender(s.user, mailFrom) {
+		logger.Warnf("SMTP发件人不在允许范围内: 用户名=%s, 发件人=%s", s.username, mailFrom)
+		return s.writer.PrintfLine("550 5.7.1 Sender address not allowed: %s", mailFrom)
 	}
 
-	// 移除尖括号
-	mailFrom = strings.Trim(mailFrom, "<>")
+	if _, ok := quotas.remaining(s.username, s.user.DailyQuota); !ok {
+		logger.Warnf("SMTP用户已用完当日配额: 用户名=%s, 配额=%d", s.username, s.user.DailyQuota)
+		return s.writer.PrintfLine("450 4.7.1 Daily message quota exceeded")
+	}
 
+	s.resetTransaction()
+	s.transaction = true
 	s.mailFrom = mailFrom
-	s.rcptTo = nil
-	s.data = nil
+	s.smtpUTF8 = smtpUTF8
 
-	return s.writer.PrintfLine("250 OK")
+	return s.writer.PrintfLine("250 2.1.0 Sender OK")
 }
 
 // handleRcpt 处理RCPT TO命令
 func (s *SMTPSession) handleRcpt(parts []string) error {
-	if s.mailFrom == "" {
-		return s.writer.PrintfLine("503 Bad sequence of commands")
+	if !s.transaction {
+		return s.writer.PrintfLine("503 5.5.1 Need MAIL command first")
 	}
 
-	if len(parts) < 2 {
-		return s.writer.PrintfLine("501 Syntax error")
+	// 解析收件人地址
+	rcptTo, params, ok := parsePath(parts, "TO:")
+	if !ok || rcptTo == "" {
+		return s.writer.PrintfLine("501 5.5.4 Syntax: RCPT TO:<address>")
+	}
+	if len(params) > 0 {
+		name, _, _ := strings.Cut(params[0], "=")
+		return s.writer.PrintfLine("555 5.5.4 Unsupported RCPT parameter: %s", name)
+	}
+	if !s.smtpUTF8 && !isASCII(rcptTo) {
+		return s.writer.PrintfLine("553 5.6.7 Non-ASCII address requires SMTPUTF8")
 	}
 
-	// 解析收件人地址
-	rcptTo := strings.Join(parts[1:], " ")
-	if strings.HasPrefix(strings.ToUpper(rcptTo), "TO:") {
-		rcptTo = strings.TrimSpace(rcptTo[3:])
+	if limit := s.maxRecipients(); limit > 0 && len(s.rcptTo) >= limit {
+		return s.writer.PrintfLine("452 4.5.3 Too many recipients")
 	}
 
-	// 移除尖括号
-	rcptTo = strings.Trim(rcptTo, "<>")
+	// 发往桥接域名的收件人必须是已配置的接收者别名，其余收件人受允许域名限制
+	if alias, ok := s.server.bridgeAlias(rcptTo); ok {
+		if !validBridgeRecipient(alias) {
+			return s.writer.PrintfLine("550 5.1.1 Unknown recipient alias: %s", alias)
+		}
+		if !allowsBridgeAlias(s.user, alias, rcptTo) {
+			logger.Warnf("SMTP中继用户无权推送到接收者: 用户名=%s, 接收者=%s", s.username, alias)
+			return s.writer.PrintfLine("550 5.7.1 Not authorized to push to %s", alias)
+		}
+	} else if !allowsRecipient(s.user, rcptTo) {
+		logger.Warnf("SMTP收件人域名不在允许范围内: 用户名=%s, 收件人=%s", s.username, rcptTo)
+		return s.writer.PrintfLine("550 5.7.1 Relay access denied: %s", rcptTo)
+	}
 
+	// 配额按收件人预占，检查和计数在同一临界区内完成
+	day, ok := quotas.reserve(s.username, s.user.DailyQuota)
+	if !ok {
+		logger.Warnf("SMTP用户已用完当日配额: 用户名=%s, 配额=%d", s.username, s.user.DailyQuota)
+		return s.writer.PrintfLine("452 4.7.1 Daily recipient quota exceeded")
+	}
+	s.quotaDay = day
+	s.quotaReserved++
 	s.rcptTo = append(s.rcptTo, rcptTo)
 
-	return s.writer.PrintfLine("250 OK")
+	return s.writer.PrintfLine("250 2.1.5 Recipient OK")
+}
+
+// maxRecipients 返回每封邮件的收件人上限，取服务器和中继用户限制中较小的一个
+func (s *SMTPSession) maxRecipients() int {
+	limit := s.server.config.Server.MaxRecipients
+	if s.user.MaxRecipients > 0 && (limit <= 0 || s.user.MaxRecipients < limit) {
+		limit = s.user.MaxRecipients
+	}
+	return limit
 }
 
 // handleData 处理DATA命令
 func (s *SMTPSession) handleData() error {
-	if len(s.rcptTo) == 0 {
-		return s.writer.PrintfLine("503 Bad sequence of commands")
+	if !s.transaction || len(s.rcptTo) == 0 {
+		return s.writer.PrintfLine("503 5.5.1 Need RCPT command first")
+	}
+	if s.chunking {
+		return s.writer.PrintfLine("503 5.5.1 DATA not allowed after BDAT")
 	}
 
-	s.writer.PrintfLine("354 Start mail input; end with <CRLF>.<CRLF>")
+	if err := s.writer.PrintfLine("354 Start mail input; end with <CRLF>.<CRLF>"); err != nil {
+		return err
+	}
 
-	// 读取邮件内容
-	var data []string
+	// 读取邮件内容，超过大小或行长度限制后继续读到结束符再拒绝
+	limit := s.server.maxMessageSize(s.user)
+	lineLimit := s.server.maxLineLength()
+	var data []byte
+	size := 0
+	lineTooLong := false
 	for {
-		line, err := s.reader.ReadLine()
+		line, err := s.readLine(lineLimit)
+		if errors.Is(err, errLineTooLong) {
+			lineTooLong = true
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -330,63 +671,215 @@ func (s *SMTPSession) handleData() error {
 			line = line[1:]
 		}
 
-		data = append(data, line)
+		size += len(line) + 2
+		if lineTooLong || (limit > 0 && size > limit) {
+			data = nil
+			continue
+		}
+		data = append(data, line...)
+		data = append(data, '\r', '\n')
+	}
+
+	if lineTooLong {
+		s.resetTransaction()
+		return s.writer.PrintfLine("500 5.5.2 Message line exceeds %d bytes", lineLimit)
+	}
+	if limit > 0 && size > limit {
+		logger.Warnf("SMTP邮件超过大小限制: 用户名=%s, 大小=%d, 限制=%d", s.username, size, limit)
+		s.resetTransaction()
+		return s.writer.PrintfLine("552 5.3.4 Message size exceeds fixed limit of %d bytes", limit)
 	}
 
 	s.data = data
+	return s.deliverMessage()
+}
+
+// handleBdat 处理BDAT命令(RFC 3030)，按声明的字节数读取数据块，LAST块到达后投递邮件
+// 无论命令能否被接受，数据块都必须读完，否则后续内容会被当作命令解析
+func (s *SMTPSession) handleBdat(parts []string) error {
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && !strings.EqualFold(parts[2], "LAST")) {
+		return s.writer.PrintfLine("501 5.5.4 Syntax: BDAT <size> [LAST]")
+	}
+	chunkSize, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || chunkSize < 0 {
+		return s.writer.PrintfLine("501 5.5.4 Invalid chunk size")
+	}
+	last := len(parts) == 3
+
+	if !s.transaction || len(s.rcptTo) == 0 {
+		if err := s.discardChunk(chunkSize); err != nil {
+			return err
+		}
+		return s.writer.PrintfLine("503 5.5.1 Need RCPT command first")
+	}
+
+	limit := s.server.maxMessageSize(s.user)
+	if limit > 0 && int64(len(s.data))+chunkSize > int64(limit) {
+		if err := s.discardChunk(chunkSize); err != nil {
+			return err
+		}
+		logger.Warnf("SMTP邮件超过大小限制: 用户名=%s, 大小>%d, 限制=%d", s.username, int64(len(s.data))+chunkSize, limit)
+		s.resetTransaction()
+		return s.writer.PrintfLine("552 5.3.4 Message size exceeds fixed limit of %d bytes", limit)
+	}
+
+	s.chunking = true
+	if s.data, err = s.readChunk(s.data, chunkSize); err != nil {
+		return err
+	}
+	if !last {
+		return s.writer.PrintfLine("250 2.0.0 %d octets received", chunkSize)
+	}
+	return s.deliverMessage()
+}
+
+// deliverMessage 投递DATA或BDAT接收的邮件并结束邮件事务
+func (s *SMTPSession) deliverMessage() error {
+	defer s.resetTransaction()
 
 	// 通过中继发送邮件
-	if err := s.relayEmail(); err != nil {
+	details := map[string]interface{}{"from": s.mailFrom, "recipients": s.rcptTo, "user": s.username}
+	reply, err := s.relayEmail(details)
+	if err != nil {
 		logger.Errorf("中继邮件发送失败: %v", err)
-		return s.writer.PrintfLine("550 Relay failed: %v", err)
+		details["error"] = err.Error()
+		s.recordAudit(audit.ActionSMTPRelay, strings.Join(s.rcptTo, ","), audit.ResultFailure, details)
+		var replyErr *smtpError
+		if errors.As(err, &replyErr) {
+			return s.writer.PrintfLine("%d %s %s", replyErr.code, replyErr.enhanced, replyErr.message)
+		}
+		return s.writer.PrintfLine("550 5.3.0 Relay failed: %v", err)
 	}
+	s.recordAudit(audit.ActionSMTPRelay, strings.Join(s.rcptTo, ","), audit.ResultSuccess, details)
+	// 投递成功后预占的配额转为正式计数，不再归还
+	s.quotaReserved = 0
 
-	return s.writer.PrintfLine("250 OK: Message accepted for delivery")
+	return s.writer.PrintfLine("250 2.0.0 OK: %s", reply)
 }
 
 // handleRset 处理RSET命令
 func (s *SMTPSession) handleRset() error {
+	s.resetTransaction()
+	return s.writer.PrintfLine("250 2.0.0 OK")
+}
+
+// resetTransaction 清空邮件事务状态，并归还未投递收件人预占的配额
+func (s *SMTPSession) resetTransaction() {
+	quotas.release(s.username, s.quotaDay, s.quotaReserved)
+	s.quotaReserved = 0
+	s.transaction = false
 	s.mailFrom = ""
+	s.smtpUTF8 = false
 	s.rcptTo = nil
 	s.data = nil
-	return s.writer.PrintfLine("250 OK")
+	s.chunking = false
 }
 
-// relayEmail 中继邮件
-func (s *SMTPSession) relayEmail() error {
-	// 解析邮件内容
-	subject := "No Subject"
-	body := strings.Join(s.data, "\n")
-	isHTML := false
-
-	// 简单解析邮件头
-	headerEnd := -1
-	for i, line := range s.data {
-		if line == "" {
-			headerEnd = i
-			break
+// recordAudit 记录SMTP会话的审计事件，调用方为smtp:<用户名>
+func (s *SMTPSession) recordAudit(action, target, result string, details map[string]interface{}) {
+	actor := "smtp:anonymous"
+	if s.username != "" {
+		actor = "smtp:" + s.username
+	}
+	audit.Record(actor, action, target, s.conn.RemoteAddr().String(), result, details)
+}
+
+// relayEmail 中继邮件，桥接域名的收件人转为推送，其余收件人写入队列或同步投递
+// 返回250响应的说明文字，并在details中记录任务ID和队列ID
+func (s *SMTPSession) relayEmail(details map[string]interface{}) (string, error) {
+	// DATA读取时已按CRLF还原行尾并去掉点号转义，BDAT为客户端提交的原始内容
+	raw := s.data
+
+	msg, err := parseMessage(raw)
+	if err != nil {
+		return "", &smtpError{554, "5.6.0", err.Error()}
+	}
+	msg.AuthUser = s.username
+	msg.MailFrom = s.mailFrom
+	msg.Raw = raw
+
+	// 先校验全部推送请求，参数错误时整封邮件拒收，此时尚未投递任何内容
+	aliases, mailRecipients := s.server.splitBridgeRecipients(s.rcptTo)
+	requests := make([]model.PushRequest, 0, len(aliases))
+	for _, alias := range aliases {
+		req, err := s.server.buildBridgeRequest(alias, msg)
+		if err != nil {
+			return "", &smtpError{550, "5.6.0", err.Error()}
 		}
+		requests = append(requests, req)
+	}
 
-		if strings.HasPrefix(strings.ToLower(line), "subject:") {
-			subject = strings.TrimSpace(line[8:])
-		} else if strings.Contains(strings.ToLower(line), "text/html") {
-			isHTML = true
+	// 先投递邮件收件人：失败时推送尚未提交，客户端重试不会导致重复推送
+	var replies []string
+	if len(mailRecipients) > 0 {
+		msg.To = mailRecipients
+		reply, err := s.deliverMail(msg, details)
+		if err != nil {
+			return "", err
 		}
+		replies = append(replies, reply)
+	}
+	if len(requests) == 0 {
+		return strings.Join(replies, "; "), nil
+	}
+
+	// 已有内容投递成功后不再返回错误，失败的接收者在响应中说明，避免客户端重试导致重复投递
+	taskIDs, failures := s.bridgeEmail(requests)
+	if len(taskIDs) == 0 && len(replies) == 0 {
+		return "", &smtpError{451, "4.3.0", strings.Join(failures, "; ")}
+	}
+	details["task_ids"] = taskIDs
+	if len(failures) > 0 {
+		details["push_failures"] = failures
 	}
+	if len(taskIDs) > 0 {
+		replies = append(replies, "pushed as "+strings.Join(taskIDs, ","))
+	}
+	return strings.Join(append(replies, failures...), "; "), nil
+}
 
-	// 提取邮件正文
-	if headerEnd >= 0 && headerEnd < len(s.data)-1 {
-		body = strings.Join(s.data[headerEnd+1:], "\n")
+// deliverMail 将邮件写入队列，未启用队列时同步投递
+func (s *SMTPSession) deliverMail(msg EmailMessage, details map[string]interface{}) (string, error) {
+	if Spool != nil {
+		queueID, err := Spool.Enqueue(s.mailFrom, msg)
+		if err != nil {
+			return "", &smtpError{451, "4.3.0", err.Error()}
+		}
+		details["queue_id"] = queueID
+		return "queued as " + queueID, nil
 	}
 
-	// 构建邮件消息
-	msg := EmailMessage{
-		To:      s.rcptTo,
-		Subject: subject,
-		Body:    body,
-		IsHTML:  isHTML,
+	// 通过中继服务发送，部分路由已投递时不能再让客户端重发，失败的收件人在响应中说明并通过系统通知报告
+	if err := s.server.relay.SendEmail(msg); err != nil {
+		var partial *partialDeliveryError
+		if !errors.As(err, &partial) || len(partial.Delivered) == 0 {
+			return "", err
+		}
+		details["delivered"] = partial.Delivered
+		details["failed_recipients"] = partial.Failed
+		return fmt.Sprintf("Message accepted for %d recipients; delivery failed for %s",
+			len(partial.Delivered), strings.Join(partial.Failed, ",")), nil
 	}
+	return "Message accepted for delivery", nil
+}
 
-	// 通过中继服务发送
-	return s.server.relay.SendEmail(msg)
+// bridgeEmail 将推送请求逐个提交到推送队列，返回成功的任务ID和失败接收者的说明，失败原因记录在日志和审计事件中
+func (s *SMTPSession) bridgeEmail(requests []model.PushRequest) ([]string, []string) {
+	caller := "smtp:" + s.username
+	var taskIDs, failures []string
+	for _, req := range requests {
+		taskID, err := SubmitPush(req, caller)
+		details := map[string]interface{}{"task_id": taskID, "type": req.Type, "strategy": req.Strategy, "title": req.Content.Title, "via": "smtp"}
+		if err != nil {
+			details["reason"] = err.Error()
+			s.recordAudit(audit.ActionPushSubmit, req.RecipientAlias, audit.ResultFailure, details)
+			logger.Errorf("邮件转换推送失败: 接收者=%s, 中继用户=%s, 错误: %v", req.RecipientAlias, s.username, err)
+			failures = append(failures, fmt.Sprintf("push to %s failed", req.RecipientAlias))
+			continue
+		}
+		s.recordAudit(audit.ActionPushSubmit, req.RecipientAlias, audit.ResultSuccess, details)
+		logger.Infof("邮件已转换为推送: 接收者=%s, 任务ID=%s, 中继用户=%s", req.RecipientAlias, taskID, s.username)
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, failures
 }
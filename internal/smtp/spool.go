@@ -0,0 +1,430 @@
+package smtp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"PushServer/internal/audit"
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+	"PushServer/internal/metrics"
+)
+
+const (
+	// defaultSpoolDir 默认队列目录
+	defaultSpoolDir = "data/smtp-spool"
+	// defaultSpoolLifetime 默认最长保留时间(秒)
+	defaultSpoolLifetime = 48 * 3600
+	// defaultSpoolScanInterval 默认检查间隔(秒)
+	defaultSpoolScanInterval = 10
+)
+
+// defaultRetrySchedule 默认重试间隔(秒)
+var defaultRetrySchedule = []int{60, 300, 900, 1800, 3600}
+
+var (
+	// ErrSpoolEntryNotFound 队列中不存在该邮件
+	ErrSpoolEntryNotFound = errors.New("队列中不存在该邮件")
+	// ErrSpoolEntryDelivering 邮件正在投递
+	ErrSpoolEntryDelivering = errors.New("邮件正在投递，请稍后重试")
+)
+
+// SpoolEntry 队列中的邮件，元数据保存为<id>.json，原始邮件保存为<id>.eml
+type SpoolEntry struct {
+	ID          string    `json:"id"`
+	MailFrom    string    `json:"mail_from"`
+	Recipients  []string  `json:"recipients"`
+	Subject     string    `json:"subject"`
+	AuthUser    string    `json:"auth_user"`
+	Size        int       `json:"size"`
+	Attempts    int       `json:"attempts"`
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+
+	delivering bool
+}
+
+// MailSpool 持久化的SMTP中继队列，邮件先落盘再按退避计划投递
+type MailSpool struct {
+	dir           string
+	relay         *RelayService
+	retrySchedule []int
+	lifetime      time.Duration
+	scanInterval  time.Duration
+
+	entries map[string]*SpoolEntry
+	mutex   sync.Mutex
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var Spool *MailSpool
+
+// InitSpool 初始化SMTP中继队列并恢复目录中未投递的邮件
+func InitSpool() error {
+	relayConfig := config.AppConfig.SMTPRelay
+	if !relayConfig.Enabled || !relayConfig.Spool.Enabled {
+		logger.Info("SMTP中继队列未启用，邮件将同步投递")
+		return nil
+	}
+
+	spoolConfig := relayConfig.Spool
+	spool := &MailSpool{
+		dir:           spoolConfig.Dir,
+		relay:         NewRelayService(),
+		retrySchedule: spoolConfig.RetrySchedule,
+		lifetime:      time.Duration(spoolConfig.Lifetime) * time.Second,
+		scanInterval:  time.Duration(spoolConfig.ScanInterval) * time.Second,
+		entries:       make(map[string]*SpoolEntry),
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if spool.dir == "" {
+		spool.dir = defaultSpoolDir
+	}
+	if len(spool.retrySchedule) == 0 {
+		spool.retrySchedule = defaultRetrySchedule
+	}
+	if spool.lifetime <= 0 {
+		spool.lifetime = defaultSpoolLifetime * time.Second
+	}
+	if spool.scanInterval <= 0 {
+		spool.scanInterval = defaultSpoolScanInterval * time.Second
+	}
+
+	if err := os.MkdirAll(spool.dir, 0700); err != nil {
+		return fmt.Errorf("创建SMTP中继队列目录失败: %v", err)
+	}
+	if err := spool.load(); err != nil {
+		return fmt.Errorf("加载SMTP中继队列失败: %v", err)
+	}
+
+	Spool = spool
+	go spool.run()
+	logger.Infof("SMTP中继队列已启用: %s, 待投递邮件: %d", spool.dir, len(spool.entries))
+	return nil
+}
+
+// load 从目录恢复队列，缺少原始邮件的元数据和没有元数据的原始邮件都会被清理
+func (sp *MailSpool) load() error {
+	files, err := filepath.Glob(filepath.Join(sp.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var entry SpoolEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.ID == "" {
+			logger.Warnf("跳过无法解析的队列文件: %s", file)
+			continue
+		}
+		if _, err := os.Stat(sp.messagePath(entry.ID)); err != nil {
+			logger.Warnf("队列邮件 %s 的原始内容丢失，已移除", entry.ID)
+			os.Remove(file)
+			continue
+		}
+		sp.entries[entry.ID] = &entry
+	}
+
+	// 写入原始邮件后、写入元数据前退出时会留下孤立文件，客户端未收到250会自行重发
+	messages, _ := filepath.Glob(filepath.Join(sp.dir, "*.eml"))
+	for _, message := range messages {
+		if _, exists := sp.entries[strings.TrimSuffix(filepath.Base(message), ".eml")]; !exists {
+			os.Remove(message)
+		}
+	}
+
+	metrics.SMTPRelaySpoolMessages.Set(float64(len(sp.entries)))
+	return nil
+}
+
+// Enqueue 将邮件写入队列，返回队列ID
+func (sp *MailSpool) Enqueue(mailFrom string, msg EmailMessage) (string, error) {
+	now := time.Now()
+	entry := &SpoolEntry{
+		ID:          generateSpoolID(now),
+		MailFrom:    mailFrom,
+		Recipients:  msg.To,
+		Subject:     msg.Subject,
+		AuthUser:    msg.AuthUser,
+		Size:        len(msg.Raw),
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+
+	// 先写原始邮件再写元数据，元数据存在即表示邮件已完整入队
+	if err := writeFileAtomic(sp.messagePath(entry.ID), msg.Raw); err != nil {
+		return "", fmt.Errorf("写入队列邮件失败: %v", err)
+	}
+	if err := sp.saveEntry(entry); err != nil {
+		os.Remove(sp.messagePath(entry.ID))
+		return "", fmt.Errorf("写入队列元数据失败: %v", err)
+	}
+
+	sp.mutex.Lock()
+	sp.entries[entry.ID] = entry
+	metrics.SMTPRelaySpoolMessages.Set(float64(len(sp.entries)))
+	sp.mutex.Unlock()
+
+	sp.notify()
+	return entry.ID, nil
+}
+
+// List 按入队时间返回队列中的邮件
+func (sp *MailSpool) List() []SpoolEntry {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	entries := make([]SpoolEntry, 0, len(sp.entries))
+	for _, entry := range sp.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries
+}
+
+// Retry 立即重试指定邮件
+func (sp *MailSpool) Retry(id string) error {
+	sp.mutex.Lock()
+	entry, exists := sp.entries[id]
+	if !exists {
+		sp.mutex.Unlock()
+		return ErrSpoolEntryNotFound
+	}
+	if entry.delivering {
+		sp.mutex.Unlock()
+		return ErrSpoolEntryDelivering
+	}
+	entry.NextAttempt = time.Now()
+	sp.mutex.Unlock()
+
+	sp.notify()
+	return nil
+}
+
+// Delete 从队列中删除邮件，不再投递
+func (sp *MailSpool) Delete(id string) error {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	entry, exists := sp.entries[id]
+	if !exists {
+		return ErrSpoolEntryNotFound
+	}
+	if entry.delivering {
+		return ErrSpoolEntryDelivering
+	}
+	sp.remove(id)
+	return nil
+}
+
+// Stop 停止投递协程，等待正在进行的投递结束
+func (sp *MailSpool) Stop() {
+	close(sp.stop)
+	<-sp.done
+}
+
+// notify 唤醒投递协程
+func (sp *MailSpool) notify() {
+	select {
+	case sp.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run 投递协程，定期或被唤醒时投递到期的邮件
+func (sp *MailSpool) run() {
+	defer close(sp.done)
+
+	ticker := time.NewTicker(sp.scanInterval)
+	defer ticker.Stop()
+
+	for {
+		sp.processDue()
+		select {
+		case <-sp.stop:
+			return
+		case <-ticker.C:
+		case <-sp.wake:
+		}
+	}
+}
+
+// processDue 依次投递到期的邮件
+func (sp *MailSpool) processDue() {
+	now := time.Now()
+	sp.mutex.Lock()
+	var due []*SpoolEntry
+	for _, entry := range sp.entries {
+		if !entry.delivering && !entry.NextAttempt.After(now) {
+			entry.delivering = true
+			due = append(due, entry)
+		}
+	}
+	sp.mutex.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	for i, entry := range due {
+		select {
+		case <-sp.stop:
+			// 停止时释放尚未投递的邮件，下次启动后继续
+			sp.mutex.Lock()
+			for _, pending := range due[i:] {
+				pending.delivering = false
+			}
+			sp.mutex.Unlock()
+			return
+		default:
+		}
+		sp.attempt(entry)
+	}
+}
+
+// attempt 投递单封邮件，失败时按退避计划安排下次重试，超过保留时间后放弃
+func (sp *MailSpool) attempt(entry *SpoolEntry) {
+	msg, err := sp.loadMessage(entry)
+	if err == nil {
+		err = sp.relay.deliver(msg)
+	}
+
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	entry.delivering = false
+
+	if err == nil {
+		logger.Infof("队列邮件投递成功: %s, 尝试次数: %d", entry.ID, entry.Attempts+1)
+		sp.remove(entry.ID)
+		return
+	}
+
+	// 拆分投递时已成功的收件人不再重试
+	var partial *partialDeliveryError
+	if errors.As(err, &partial) && len(partial.Delivered) > 0 {
+		logger.Infof("队列邮件 %s 已投递给 %d 个收件人，剩余 %d 个稍后重试", entry.ID, len(partial.Delivered), len(partial.Failed))
+		entry.Recipients = partial.Failed
+		msg.To = partial.Failed
+	}
+
+	entry.Attempts++
+	entry.LastError = err.Error()
+	age := time.Since(entry.CreatedAt)
+	if age >= sp.lifetime {
+		logger.Errorf("队列邮件 %s 超过保留时间仍未投递成功，已放弃: %v", entry.ID, err)
+		sp.remove(entry.ID)
+		metrics.SMTPRelayDeliveryFailuresTotal.Inc()
+		sp.relay.triggerSystemNotification(msg, fmt.Errorf("邮件在队列中保留 %s、尝试 %d 次后仍未投递成功，最后错误: %v",
+			age.Round(time.Second), entry.Attempts, err))
+		audit.Record("system", audit.ActionSMTPQueueExpire, entry.ID, "", audit.ResultFailure, map[string]interface{}{
+			"user":       entry.AuthUser,
+			"recipients": entry.Recipients,
+			"attempts":   entry.Attempts,
+			"error":      entry.LastError,
+		})
+		return
+	}
+
+	entry.NextAttempt = time.Now().Add(sp.backoff(entry.Attempts))
+	logger.Warnf("队列邮件 %s 第 %d 次投递失败，将于 %s 重试: %v",
+		entry.ID, entry.Attempts, entry.NextAttempt.Format("2006-01-02 15:04:05"), err)
+	if err := sp.saveEntry(entry); err != nil {
+		logger.Errorf("更新队列元数据失败: %s, %v", entry.ID, err)
+	}
+}
+
+// loadMessage 读取并解析队列中的原始邮件
+func (sp *MailSpool) loadMessage(entry *SpoolEntry) (EmailMessage, error) {
+	raw, err := os.ReadFile(sp.messagePath(entry.ID))
+	if err != nil {
+		return EmailMessage{To: entry.Recipients, Subject: entry.Subject, AuthUser: entry.AuthUser}, fmt.Errorf("读取队列邮件失败: %v", err)
+	}
+	msg, err := parseMessage(raw)
+	msg.To = entry.Recipients
+	msg.AuthUser = entry.AuthUser
+	msg.MailFrom = entry.MailFrom
+	msg.Raw = raw
+	return msg, err
+}
+
+// backoff 返回第attempts次失败后的等待时间
+func (sp *MailSpool) backoff(attempts int) time.Duration {
+	index := attempts - 1
+	if index >= len(sp.retrySchedule) {
+		index = len(sp.retrySchedule) - 1
+	}
+	return time.Duration(sp.retrySchedule[index]) * time.Second
+}
+
+// remove 删除队列文件和内存记录，调用方需持有锁
+func (sp *MailSpool) remove(id string) {
+	os.Remove(sp.entryPath(id))
+	os.Remove(sp.messagePath(id))
+	delete(sp.entries, id)
+	metrics.SMTPRelaySpoolMessages.Set(float64(len(sp.entries)))
+}
+
+// saveEntry 保存元数据
+func (sp *MailSpool) saveEntry(entry *SpoolEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sp.entryPath(entry.ID), data)
+}
+
+func (sp *MailSpool) entryPath(id string) string {
+	return filepath.Join(sp.dir, id+".json")
+}
+
+func (sp *MailSpool) messagePath(id string) string {
+	return filepath.Join(sp.dir, id+".eml")
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免中途退出留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// generateSpoolID 生成队列ID
+func generateSpoolID(now time.Time) string {
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	return now.Format("20060102150405") + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,363 @@
+package statistics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"PushServer/internal/task"
+)
+
+// 统计维度
+const (
+	DimensionPlatform  = "platform"
+	DimensionWebhook   = "webhook"
+	DimensionRecipient = "recipient"
+)
+
+const (
+	// bucketSize 汇总桶的时间粒度
+	bucketSize = time.Minute
+	// maxReasonsPerRollup 每个汇总项最多记录的失败原因种类，超出部分归入"其他"
+	maxReasonsPerRollup = 20
+	// maxReasonLength 失败原因的最大长度(字符)
+	maxReasonLength = 120
+	// topReasons 报告中返回的失败原因数量
+	topReasons = 5
+	// otherReason 超出种类上限的失败原因
+	otherReason = "其他"
+)
+
+// latencyBounds 耗时直方图的桶上界(毫秒)，最后一个桶为无穷大
+var latencyBounds = []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// rollup 单个维度值在一个时间桶内的汇总
+type rollup struct {
+	total     int64
+	success   int64
+	failed    int64
+	latencies []int64 // 长度为len(latencyBounds)+1
+	reasons   map[string]int64
+}
+
+func newRollup() *rollup {
+	return &rollup{
+		latencies: make([]int64, len(latencyBounds)+1),
+		reasons:   make(map[string]int64),
+	}
+}
+
+// merge 合并另一个汇总
+func (r *rollup) merge(other *rollup) {
+	r.total += other.total
+	r.success += other.success
+	r.failed += other.failed
+	for i, count := range other.latencies {
+		r.latencies[i] += count
+	}
+	for reason, count := range other.reasons {
+		r.reasons[reason] += count
+	}
+}
+
+// dimensionKey 维度键
+type dimensionKey struct {
+	dimension string
+	name      string
+}
+
+// bucket 一个时间桶内的汇总数据
+type bucket struct {
+	tasks     int64
+	fallbacks int64
+	rollups   map[dimensionKey]*rollup
+}
+
+// Recorder 推送结果统计器，汇总数据独立于任务保存，不受任务清理影响
+type Recorder struct {
+	buckets   map[int64]*bucket
+	mutex     sync.Mutex
+	retention time.Duration
+}
+
+// Summary 单个维度值的统计结果
+type Summary struct {
+	Name           string          `json:"name"`
+	Total          int64           `json:"total"`
+	Success        int64           `json:"success"`
+	Failed         int64           `json:"failed"`
+	SuccessRate    float64         `json:"success_rate"`
+	P50LatencyMs   float64         `json:"p50_latency_ms"`
+	P95LatencyMs   float64         `json:"p95_latency_ms"`
+	FailureReasons []FailureReason `json:"failure_reasons,omitempty"`
+}
+
+// FailureReason 失败原因及次数
+type FailureReason struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// Report 统计报告
+type Report struct {
+	Window       string    `json:"window"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Tasks        int64     `json:"tasks"`
+	Fallbacks    int64     `json:"fallbacks"`
+	FallbackRate float64   `json:"fallback_rate"`
+	Overall      Summary   `json:"overall"`
+	Platforms    []Summary `json:"platforms"`
+	Webhooks     []Summary `json:"webhooks"`
+	Recipients   []Summary `json:"recipients"`
+}
+
+var Manager *Recorder
+
+// InitStatistics 初始化统计器，retention为汇总数据保留时长(小时)
+func InitStatistics(retention int) {
+	if retention <= 0 {
+		retention = 24 * 7
+	}
+
+	Manager = &Recorder{
+		buckets:   make(map[int64]*bucket),
+		retention: time.Duration(retention) * time.Hour,
+	}
+}
+
+// Retention 获取汇总数据保留时长
+func (r *Recorder) Retention() time.Duration {
+	return r.retention
+}
+
+// RecordTask 记录一个开始执行的推送任务
+func (r *Recorder) RecordTask() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.currentBucket().tasks++
+}
+
+// RecordFallback 记录一次触发系统通知兜底
+func (r *Recorder) RecordFallback() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.currentBucket().fallbacks++
+}
+
+// RecordResult 记录一次推送结果
+func (r *Recorder) RecordResult(recipientAlias string, result task.PushResult, latency time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b := r.currentBucket()
+	keys := []dimensionKey{
+		{dimension: DimensionPlatform, name: result.Platform},
+		{dimension: DimensionWebhook, name: result.Platform + "/" + result.Webhook},
+		{dimension: DimensionRecipient, name: recipientAlias},
+	}
+
+	latencyIndex := latencyBucketIndex(float64(latency) / float64(time.Millisecond))
+	reason := normalizeReason(result.Message)
+
+	for _, key := range keys {
+		ru, exists := b.rollups[key]
+		if !exists {
+			ru = newRollup()
+			b.rollups[key] = ru
+		}
+
+		ru.total++
+		ru.latencies[latencyIndex]++
+		if result.Status == "success" {
+			ru.success++
+			continue
+		}
+
+		ru.failed++
+		if _, known := ru.reasons[reason]; known || len(ru.reasons) < maxReasonsPerRollup {
+			ru.reasons[reason]++
+		} else {
+			ru.reasons[otherReason]++
+		}
+	}
+}
+
+// Report 生成指定时间窗口内的统计报告
+func (r *Recorder) Report(window time.Duration) Report {
+	now := time.Now()
+	from := now.Add(-window)
+	fromKey := from.Truncate(bucketSize).Unix()
+
+	merged := make(map[dimensionKey]*rollup)
+	report := Report{
+		Window: window.String(),
+		From:   from,
+		To:     now,
+	}
+
+	r.mutex.Lock()
+	for key, b := range r.buckets {
+		if key < fromKey {
+			continue
+		}
+		report.Tasks += b.tasks
+		report.Fallbacks += b.fallbacks
+		for dimKey, ru := range b.rollups {
+			target, exists := merged[dimKey]
+			if !exists {
+				target = newRollup()
+				merged[dimKey] = target
+			}
+			target.merge(ru)
+		}
+	}
+	r.mutex.Unlock()
+
+	if report.Tasks > 0 {
+		report.FallbackRate = float64(report.Fallbacks) / float64(report.Tasks)
+	}
+
+	overall := newRollup()
+	report.Platforms = make([]Summary, 0)
+	report.Webhooks = make([]Summary, 0)
+	report.Recipients = make([]Summary, 0)
+	for dimKey, ru := range merged {
+		summary := summarize(dimKey.name, ru)
+		switch dimKey.dimension {
+		case DimensionPlatform:
+			overall.merge(ru)
+			report.Platforms = append(report.Platforms, summary)
+		case DimensionWebhook:
+			report.Webhooks = append(report.Webhooks, summary)
+		case DimensionRecipient:
+			report.Recipients = append(report.Recipients, summary)
+		}
+	}
+	report.Overall = summarize("overall", overall)
+
+	sortSummaries(report.Platforms)
+	sortSummaries(report.Webhooks)
+	sortSummaries(report.Recipients)
+
+	return report
+}
+
+// currentBucket 获取当前时间桶，调用方需持有锁
+func (r *Recorder) currentBucket() *bucket {
+	key := time.Now().Truncate(bucketSize).Unix()
+	b, exists := r.buckets[key]
+	if !exists {
+		b = &bucket{rollups: make(map[dimensionKey]*rollup)}
+		r.buckets[key] = b
+		r.pruneLocked()
+	}
+	return b
+}
+
+// pruneLocked 删除超过保留时长的时间桶，调用方需持有锁
+func (r *Recorder) pruneLocked() {
+	expireBefore := time.Now().Add(-r.retention).Unix()
+	for key := range r.buckets {
+		if key < expireBefore {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// summarize 将汇总转换为统计结果
+func summarize(name string, ru *rollup) Summary {
+	summary := Summary{
+		Name:         name,
+		Total:        ru.total,
+		Success:      ru.success,
+		Failed:       ru.failed,
+		P50LatencyMs: percentile(ru.latencies, 0.50),
+		P95LatencyMs: percentile(ru.latencies, 0.95),
+	}
+	if ru.total > 0 {
+		summary.SuccessRate = float64(ru.success) / float64(ru.total)
+	}
+
+	for reason, count := range ru.reasons {
+		summary.FailureReasons = append(summary.FailureReasons, FailureReason{Reason: reason, Count: count})
+	}
+	sort.Slice(summary.FailureReasons, func(i, j int) bool {
+		if summary.FailureReasons[i].Count != summary.FailureReasons[j].Count {
+			return summary.FailureReasons[i].Count > summary.FailureReasons[j].Count
+		}
+		return summary.FailureReasons[i].Reason < summary.FailureReasons[j].Reason
+	})
+	if len(summary.FailureReasons) > topReasons {
+		summary.FailureReasons = summary.FailureReasons[:topReasons]
+	}
+
+	return summary
+}
+
+// sortSummaries 按推送总数倒序排列
+func sortSummaries(summaries []Summary) {
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Total != summaries[j].Total {
+			return summaries[i].Total > summaries[j].Total
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+}
+
+// latencyBucketIndex 获取耗时所在的直方图桶
+func latencyBucketIndex(latencyMs float64) int {
+	for i, bound := range latencyBounds {
+		if latencyMs <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// percentile 根据直方图估算分位数(毫秒)，在桶内做线性插值
+func percentile(counts []int64, q float64) float64 {
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	var cumulative int64
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		if float64(cumulative+count) >= rank {
+			lower := 0.0
+			if i > 0 {
+				lower = latencyBounds[i-1]
+			}
+			if i >= len(latencyBounds) {
+				// 超出最大桶上界时无法插值，返回最大上界
+				return latencyBounds[len(latencyBounds)-1]
+			}
+			upper := latencyBounds[i]
+			return lower + (upper-lower)*(rank-float64(cumulative))/float64(count)
+		}
+		cumulative += count
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// normalizeReason 规范化失败原因
+func normalizeReason(message string) string {
+	if message == "" {
+		return "未知错误"
+	}
+	runes := []rune(message)
+	if len(runes) > maxReasonLength {
+		return string(runes[:maxReasonLength]) + "..."
+	}
+	return message
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"PushServer/internal/redact"
 )
 
 // TaskStatus 任务状态
@@ -29,6 +31,8 @@ type Task struct {
 	Results     []PushResult           `json:"results"`     // 推送结果
 	Error       string                 `json:"error,omitempty"` // 错误信息
 	Progress    TaskProgress           `json:"progress"`    // 进度信息
+	TraceID     string                 `json:"trace_id,omitempty"` // 链路追踪ID
+	Caller      string                 `json:"caller,omitempty"`   // 调用方，如 api_key:ops-script
 }
 
 // TaskProgress 任务进度
@@ -112,6 +116,9 @@ func (tm *TaskManager) UpdateTask(id string, updater func(*Task)) {
 
 // AddResult 添加推送结果
 func (tm *TaskManager) AddResult(id string, result PushResult) {
+	// 错误信息可能包含webhook地址中的令牌
+	result.Message = redact.String(result.Message)
+
 	tm.UpdateTask(id, func(task *Task) {
 		task.Results = append(task.Results, result)
 		
@@ -149,16 +156,48 @@ func (tm *TaskManager) SetTaskTotal(id string, total int) {
 	})
 }
 
+// SetTraceID 设置任务的链路追踪ID
+func (tm *TaskManager) SetTraceID(id string, traceID string) {
+	tm.UpdateTask(id, func(task *Task) {
+		task.TraceID = traceID
+	})
+}
+
+// SetCaller 设置任务的调用方
+func (tm *TaskManager) SetCaller(id string, caller string) {
+	tm.UpdateTask(id, func(task *Task) {
+		task.Caller = caller
+	})
+}
+
 // SetTaskError 设置任务错误
 func (tm *TaskManager) SetTaskError(id string, err string) {
 	tm.UpdateTask(id, func(task *Task) {
 		task.Status = StatusFailed
-		task.Error = err
+		task.Error = redact.String(err)
 		now := time.Now()
 		task.CompletedAt = &now
 	})
 }
 
+// CountByStatus 按状态统计当前保存的任务数
+func (tm *TaskManager) CountByStatus() map[TaskStatus]int {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	counts := map[TaskStatus]int{
+		StatusPending:    0,
+		StatusProcessing: 0,
+		StatusSuccess:    0,
+		StatusFailed:     0,
+		StatusPartial:    0,
+	}
+	for _, task := range tm.tasks {
+		counts[task.Status]++
+	}
+	return counts
+}
+
 // cleanup 清理过期任务
 func (tm *TaskManager) cleanup() {
 	for range tm.cleanupTick.C {
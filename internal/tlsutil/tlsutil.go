@@ -0,0 +1,93 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"PushServer/internal/logger"
+)
+
+// DefaultReloadInterval 默认检查证书文件变化的间隔
+const DefaultReloadInterval = time.Minute
+
+// CertReloader 证书热加载，证书文件修改后在下次握手时自动重新加载
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+	mutex     sync.Mutex
+}
+
+// NewCertReloader 创建证书热加载器并加载初始证书，interval为0时使用默认间隔
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// load 读取证书和私钥
+func (cr *CertReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %w", err)
+	}
+	cr.cert = &cert
+	cr.modTime = cr.latestModTime()
+	cr.checkedAt = time.Now()
+	return nil
+}
+
+// latestModTime 证书和私钥文件中较新的修改时间
+func (cr *CertReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, file := range []string{cr.certFile, cr.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// GetCertificate 供tls.Config使用，按间隔检查文件是否更新
+// 重新加载失败时继续使用旧证书，避免证书轮换过程中出现中断
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if time.Since(cr.checkedAt) >= cr.interval {
+		cr.checkedAt = time.Now()
+		if modTime := cr.latestModTime(); modTime.After(cr.modTime) {
+			if err := cr.load(); err != nil {
+				logger.Errorf("重新加载TLS证书失败，继续使用旧证书: %v", err)
+			} else {
+				logger.Infof("TLS证书已重新加载: %s", cr.certFile)
+			}
+		}
+	}
+
+	return cr.cert, nil
+}
+
+// ParseMinVersion 解析最低TLS版本配置，默认TLS 1.2
+func ParseMinVersion(version string) uint16 {
+	if version == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+const tracerName = "PushServer"
+
+// InitTracer 初始化链路追踪，返回用于关闭导出器的函数
+func InitTracer() (func(context.Context) error, error) {
+	// 无论是否启用导出，都接受并向下游传递W3C traceparent
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	cfg := config.AppConfig.Tracing
+	if !cfg.Enabled {
+		logger.Info("链路追踪导出未启用")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+	}
+	if len(cfg.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("创建OTLP导出器失败: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = tracerName
+	}
+
+	sampleRatio := cfg.SampleRatio
+	if sampleRatio <= 0 || sampleRatio > 1 {
+		sampleRatio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.Infof("链路追踪已启用，OTLP地址: %s, 采样率: %.2f", cfg.Endpoint, sampleRatio)
+	return provider.Shutdown, nil
+}
+
+// Tracer 获取追踪器
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Extract 从HTTP请求头中提取上游传入的追踪上下文
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceID 获取上下文中的追踪ID，不存在时返回空字符串
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// NewHTTPClient 创建带追踪埋点的HTTP客户端
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+}
@@ -0,0 +1,182 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"PushServer/internal/config"
+	"PushServer/internal/logger"
+)
+
+const (
+	incomingTraceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingParentID = "00f067aa0ba902b7"
+)
+
+// collectorStub 模拟OTLP/HTTP接收端，记录收到的span
+type collectorStub struct {
+	mutex    sync.Mutex
+	paths    []string
+	spans    []*tracepb.Span
+	services []string
+}
+
+func (c *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, attr := range resourceSpans.GetResource().GetAttributes() {
+			if attr.Key == "service.name" {
+				c.services = append(c.services, attr.GetValue().GetStringValue())
+			}
+		}
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Write(resp)
+}
+
+func (c *collectorStub) span(name string) *tracepb.Span {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func setupTracer(t *testing.T, collector *collectorStub) func(context.Context) error {
+	t.Helper()
+	logger.Logger = logrus.New()
+	logger.Logger.SetOutput(io.Discard)
+
+	server := httptest.NewServer(collector)
+	t.Cleanup(server.Close)
+
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+	config.AppConfig = &config.Config{
+		Tracing: config.TracingConfig{
+			Enabled:     true,
+			Endpoint:    server.URL + "/v1/traces",
+			ServiceName: "push-test",
+		},
+	}
+
+	shutdown, err := InitTracer()
+	if err != nil {
+		t.Fatalf("InitTracer: %v", err)
+	}
+	return shutdown
+}
+
+func TestExportToCollectorContinuesIncomingTrace(t *testing.T) {
+	collector := &collectorStub{}
+	shutdown := setupTracer(t, collector)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-"+incomingTraceID+"-"+incomingParentID+"-01")
+	ctx := Extract(context.Background(), header)
+
+	ctx, parent := Tracer().Start(ctx, "handler.PushMessage")
+	if got := TraceID(ctx); got != incomingTraceID {
+		t.Fatalf("TraceID = %q, want %q", got, incomingTraceID)
+	}
+	_, child := Tracer().Start(ctx, "platform.Send")
+	child.End()
+	parent.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if len(collector.paths) == 0 || collector.paths[0] != "/v1/traces" {
+		t.Fatalf("collector paths = %v, want /v1/traces", collector.paths)
+	}
+	if len(collector.services) == 0 || collector.services[0] != "push-test" {
+		t.Errorf("service.name = %v, want push-test", collector.services)
+	}
+
+	handlerSpan := collector.span("handler.PushMessage")
+	if handlerSpan == nil {
+		t.Fatal("handler.PushMessage span not exported")
+	}
+	if got := hex.EncodeToString(handlerSpan.TraceId); got != incomingTraceID {
+		t.Errorf("exported trace id = %s, want %s", got, incomingTraceID)
+	}
+	if got := hex.EncodeToString(handlerSpan.ParentSpanId); got != incomingParentID {
+		t.Errorf("exported parent span id = %s, want %s", got, incomingParentID)
+	}
+
+	sendSpan := collector.span("platform.Send")
+	if sendSpan == nil {
+		t.Fatal("platform.Send span not exported")
+	}
+	if string(sendSpan.ParentSpanId) != string(handlerSpan.SpanId) {
+		t.Errorf("platform.Send parent = %x, want %x", sendSpan.ParentSpanId, handlerSpan.SpanId)
+	}
+}
+
+func TestHTTPClientPropagatesTraceparent(t *testing.T) {
+	collector := &collectorStub{}
+	shutdown := setupTracer(t, collector)
+
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, span := Tracer().Start(context.Background(), "platform.Send")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewHTTPClient(0).Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	traceID := span.SpanContext().TraceID().String()
+	if !strings.Contains(received, traceID) {
+		t.Errorf("outbound traceparent = %q, want trace id %s", received, traceID)
+	}
+	if collector.span("HTTP POST") == nil {
+		t.Error("outbound HTTP client span not exported")
+	}
+}
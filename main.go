@@ -1,29 +1,76 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
+	"time"
 
+	"PushServer/internal/audit"
+	"PushServer/internal/auth"
 	"PushServer/internal/config"
+	"PushServer/internal/dkim"
+	"PushServer/internal/health"
 	"PushServer/internal/logger"
+	"PushServer/internal/model"
 	"PushServer/internal/notification"
 	"PushServer/internal/queue"
+	"PushServer/internal/ratelimit"
+	"PushServer/internal/redact"
 	"PushServer/internal/server"
 	"PushServer/internal/smtp"
+	"PushServer/internal/statistics"
 	"PushServer/internal/task"
+	"PushServer/internal/tracing"
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "encrypt":
+			runEncrypt(os.Args[2:])
+			return
+		case "hash-password":
+			runHashPassword(os.Args[2:])
+			return
+		case "gen-key":
+			key, err := config.GenerateMasterKey()
+			if err != nil {
+				log.Fatalf("生成主密钥失败: %v", err)
+			}
+			fmt.Println(key)
+			return
+		}
+	}
+
 	// 解析命令行参数
-	var configPath string
+	var configPath, hashKey string
 	flag.StringVar(&configPath, "config", "config/config.yaml", "配置文件路径")
+	flag.StringVar(&hashKey, "hash-key", "", "输出API密钥的key_hash后退出")
 	flag.Parse()
 
+	if hashKey != "" {
+		fmt.Println(auth.HashKey(hashKey))
+		return
+	}
+
 	// 加载配置文件
 	if err := config.LoadConfig(configPath); err != nil {
 		log.Fatalf("加载配置文件失败: %v", err)
 	}
 
+	// 初始化脱敏规则，需在日志之前完成
+	if err := redact.InitRedaction(); err != nil {
+		log.Fatalf("脱敏规则配置无效: %v", err)
+	}
+
 	// 初始化日志
 	if err := logger.InitLogger(); err != nil {
 		log.Fatalf("初始化日志失败: %v", err)
@@ -31,13 +78,39 @@ func main() {
 
 	logger.Info("消息推送服务启动中...")
 	logger.Infof("配置文件: %s", configPath)
+	for _, deprecation := range config.Deprecations {
+		logger.Warn(deprecation)
+	}
 	logger.Infof("服务地址: %s", config.AppConfig.GetServerAddr())
 	logger.Infof("运行模式: %s", config.AppConfig.Server.Mode)
 
+	// 初始化审计日志，记录本次加载的配置文件摘要
+	if err := audit.InitAudit(); err != nil {
+		log.Fatalf("初始化审计日志失败: %v", err)
+	}
+	audit.Record("system", audit.ActionConfigLoad, configPath, "", audit.ResultSuccess,
+		map[string]interface{}{"sha256": fileSHA256(configPath)})
+
+	// 初始化链路追踪
+	shutdownTracer, err := tracing.InitTracer()
+	if err != nil {
+		log.Fatalf("初始化链路追踪失败: %v", err)
+	}
+
+	// 初始化接口认证
+	auth.InitAuth()
+
+	// 初始化推送接口限流
+	ratelimit.InitRateLimit()
+
 	// 初始化任务管理器
 	task.InitTaskManager(config.AppConfig.Task.CleanupInterval, config.AppConfig.Task.MaxAge)
 	logger.Info("任务管理器初始化完成")
 
+	// 初始化投递统计
+	statistics.InitStatistics(config.AppConfig.Statistics.Retention)
+	logger.Info("投递统计初始化完成")
+
 	// 初始化通知管理器
 	notification.InitNotificationManager(1000)
 	logger.Info("通知管理器初始化完成")
@@ -46,12 +119,28 @@ func main() {
 	queue.InitQueue()
 	logger.Info("队列系统初始化完成")
 
-	// 启动SMTP中继服务器
+	// 加载DKIM签名私钥
+	if err := dkim.InitDKIM(); err != nil {
+		log.Fatalf("DKIM签名配置无效: %v", err)
+	}
+
+	// 初始化SMTP中继队列
+	// 启用队列时必须初始化成功，否则退化为同步投递会在投递失败时丢失邮件
+	if err := smtp.InitSpool(); err != nil {
+		log.Fatalf("SMTP中继队列初始化失败: %v", err)
+	}
+
+	// 启动SMTP中继服务器，桥接邮件通过推送队列发送
+	smtp.SubmitPush = submitSMTPPush
 	smtpServer := smtp.NewSMTPServer()
 	if err := smtpServer.Start(); err != nil {
 		logger.Errorf("SMTP中继服务器启动失败: %v", err)
 	}
 
+	// 注册健康检查
+	health.RegisterDefaultChecks()
+	health.RegisterSMTPChecks(smtpServer)
+
 	// 启动HTTP服务器
 	srv := server.NewServer()
 	if err := srv.Start(); err != nil {
@@ -59,7 +148,96 @@ func main() {
 	}
 
 	// 优雅关闭
+	// 先停止SMTP服务器和中继队列，正在结束的会话和投递协程仍会向推送队列提交桥接推送，
+	// 推送队列和任务管理器必须在它们之后停止
+	smtpServer.Stop()
+	if smtp.Spool != nil {
+		smtp.Spool.Stop()
+	}
 	queue.PushQueue.Stop()
 	task.Manager.Stop()
-	smtpServer.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracer(ctx); err != nil {
+		logger.Errorf("关闭链路追踪失败: %v", err)
+	}
+}
+
+// submitSMTPPush 创建任务并将SMTP桥接邮件转换出的推送请求加入推送队列
+func submitSMTPPush(req model.PushRequest, caller string) (string, error) {
+	if allowed, wait := ratelimit.Allow(ratelimit.DimensionRecipient, req.RecipientAlias); !allowed {
+		return "", fmt.Errorf("接收者 %s 请求过于频繁，请在 %s 后重试", req.RecipientAlias, wait.Round(time.Second))
+	}
+
+	newTask := task.Manager.CreateTask(req)
+	task.Manager.SetCaller(newTask.ID, caller)
+
+	job := queue.PushJob{
+		TaskID:       newTask.ID,
+		Request:      req,
+		EnqueuedAt:   time.Now(),
+		TraceContext: context.Background(),
+	}
+	if err := queue.PushQueue.AddJob(job); err != nil {
+		task.Manager.SetTaskError(newTask.ID, "队列已满，请稍后重试")
+		return newTask.ID, err
+	}
+	return newTask.ID, nil
+}
+
+// runEncrypt 使用主密钥加密配置值，输出可直接写入配置文件的enc:密文
+// 未传入参数时从标准输入读取，避免明文出现在shell历史中
+func runEncrypt(args []string) {
+	key, err := config.LoadMasterKey()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	var plaintext string
+	if len(args) > 0 {
+		plaintext = args[0]
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("读取标准输入失败: %v", err)
+		}
+		plaintext = strings.TrimRight(string(data), "\r\n")
+	}
+
+	encrypted, err := config.EncryptValue(key, plaintext)
+	if err != nil {
+		log.Fatalf("加密失败: %v", err)
+	}
+	fmt.Println(encrypted)
+}
+
+// runHashPassword 生成SMTP中继用户的bcrypt密码哈希，未传入参数时从标准输入读取
+func runHashPassword(args []string) {
+	var password string
+	if len(args) > 0 {
+		password = args[0]
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("读取标准输入失败: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	hash, err := smtp.HashPassword(password)
+	if err != nil {
+		log.Fatalf("生成密码哈希失败: %v", err)
+	}
+	fmt.Println(hash)
+}
+
+// fileSHA256 计算文件的SHA-256摘要，读取失败时返回空字符串
+func fileSHA256(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }